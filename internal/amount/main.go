@@ -0,0 +1,65 @@
+package amount
+
+import (
+	"math/big"
+	"strings"
+
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// PricePrecision is the number of decimal places of the price
+const PricePrecision = 18
+
+// Normalized amounts are decimal strings with the token decimals applied, the
+// fields are empty when the decimals of the token are unknown
+type Normalized struct {
+	AmountToSell string `json:"normalized_amount_to_sell,omitempty"`
+	AmountToBuy  string `json:"normalized_amount_to_buy,omitempty"`
+	// Price is the amount of the token to buy per one token to sell
+	Price string `json:"price,omitempty"`
+}
+
+// Normalize divides the raw integer amount by 10^decimals
+func Normalize(raw string, decimals uint8) (string, error) {
+	r, err := normalize(raw, decimals)
+	if err != nil {
+		return "", err
+	}
+	return format(r, int(decimals)), nil
+}
+
+// Price divides the normalized amount to buy by the normalized amount to sell,
+// it is empty when the amount to sell is zero
+func Price(rawSell string, sellDecimals uint8, rawBuy string, buyDecimals uint8) (string, error) {
+	sell, err := normalize(rawSell, sellDecimals)
+	if err != nil {
+		return "", err
+	}
+	buy, err := normalize(rawBuy, buyDecimals)
+	if err != nil {
+		return "", err
+	}
+	if sell.Sign() == 0 {
+		return "", nil
+	}
+	return format(new(big.Rat).Quo(buy, sell), PricePrecision), nil
+}
+
+func normalize(raw string, decimals uint8) (*big.Rat, error) {
+	n, ok := new(big.Int).SetString(raw, 10)
+	if !ok {
+		return nil, errors.From(errors.New("invalid integer amount"), logan.F{"amount": raw})
+	}
+	denom := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	return new(big.Rat).SetFrac(n, denom), nil
+}
+
+// format drops the trailing zeros of the fractional part
+func format(r *big.Rat, prec int) string {
+	s := r.FloatString(prec)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
@@ -0,0 +1,76 @@
+package amount
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		raw      string
+		decimals uint8
+		want     string
+		err      bool
+	}{
+		{raw: "0", decimals: 18, want: "0"},
+		{raw: "1000000000000000000", decimals: 18, want: "1"},
+		{raw: "1500000", decimals: 6, want: "1.5"},
+		{raw: "1", decimals: 18, want: "0.000000000000000001"},
+		{raw: "123", decimals: 0, want: "123"},
+		{raw: "120", decimals: 1, want: "12"},
+		{raw: "115792089237316195423570985008687907853269984665640564039457584007913129639935", decimals: 18,
+			want: "115792089237316195423570985008687907853269984665640564039457.584007913129639935"},
+		{raw: "", decimals: 18, err: true},
+		{raw: "1.5", decimals: 18, err: true},
+		{raw: "0x10", decimals: 18, err: true},
+	}
+	for _, c := range cases {
+		got, err := Normalize(c.raw, c.decimals)
+		if c.err {
+			if err == nil {
+				t.Errorf("Normalize(%q, %d) = %q, want error", c.raw, c.decimals, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Normalize(%q, %d) failed: %v", c.raw, c.decimals, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("Normalize(%q, %d) = %q, want %q", c.raw, c.decimals, got, c.want)
+		}
+	}
+}
+
+func TestPrice(t *testing.T) {
+	cases := []struct {
+		name         string
+		sell         string
+		sellDecimals uint8
+		buy          string
+		buyDecimals  uint8
+		want         string
+		err          bool
+	}{
+		{name: "same decimals", sell: "2000", sellDecimals: 3, buy: "3000", buyDecimals: 3, want: "1.5"},
+		{name: "different decimals", sell: "1000000000000000000", sellDecimals: 18, buy: "2500000", buyDecimals: 6, want: "2.5"},
+		{name: "rounded to precision", sell: "3", buy: "1", want: "0.333333333333333333"},
+		{name: "zero to buy", sell: "5", buy: "0", want: "0"},
+		{name: "zero to sell", sell: "0", buy: "5", want: ""},
+		{name: "invalid to sell", sell: "x", buy: "5", err: true},
+		{name: "invalid to buy", sell: "5", buy: "x", err: true},
+	}
+	for _, c := range cases {
+		got, err := Price(c.sell, c.sellDecimals, c.buy, c.buyDecimals)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: Price = %q, want error", c.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Price failed: %v", c.name, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: Price = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Swapica/indexer-svc/internal/notify"
+)
+
+const keepAlivePeriod = 15 * time.Second
+
+// events serves GET /events?creator=&token=&order_id=&cursor= as Server-Sent
+// Events, the cursor may also be passed in Last-Event-ID header on reconnect
+func (h handler) events(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	q := r.URL.Query()
+	filter := notify.Filter{
+		Creator: q.Get("creator"),
+		Token:   q.Get("token"),
+	}
+	if raw := q.Get("order_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid order_id")
+			return
+		}
+		filter.OrderID = &id
+	}
+
+	var cursor *string
+	if c := r.Header.Get("Last-Event-ID"); c != "" {
+		cursor = &c
+	} else if c = q.Get("cursor"); c != "" {
+		cursor = &c
+	}
+
+	backlog, events, unsubscribe, err := h.broker.Subscribe(filter, cursor)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, e := range backlog {
+		if writeEvent(w, e) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAlivePeriod)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err = fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-events:
+			if !ok {
+				// the subscriber was too slow, the client reconnects with Last-Event-ID
+				return
+			}
+			if writeEvent(w, e) != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e notify.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.Cursor, e.Type, data)
+	return err
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/Swapica/indexer-svc/internal/store"
+	"github.com/Swapica/indexer-svc/internal/stream"
+	"gitlab.com/distributed_lab/logan/v3"
+)
+
+// Run serves the read-only JSON:API of the local store and the stream of the
+// indexed events until ctx is done
+func Run(ctx context.Context, log *logan.Entry, addr string, s *store.Store, broker *stream.Broker, chainID int64) {
+	h := handler{store: s, broker: broker, chainID: chainID, log: log}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orders", h.listOrders)
+	mux.HandleFunc("/orders/", h.getOrder)
+	mux.HandleFunc("/match_orders", h.listMatches)
+	mux.HandleFunc("/match_orders/", h.getMatch)
+	mux.HandleFunc("/events", h.events)
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	log.WithField("addr", addr).Info("query API started")
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.WithError(err).Error("query API failed")
+	}
+}
+
+type handler struct {
+	store   *store.Store
+	broker  *stream.Broker
+	chainID int64
+	log     *logan.Entry
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+type errorObject struct {
+	Status string `json:"status"`
+	Title  string `json:"title"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, status int, detail string) {
+	writeJSON(w, status, map[string][]errorObject{
+		"errors": {{
+			Status: http.StatusText(status),
+			Title:  http.StatusText(status),
+			Detail: detail,
+		}},
+	})
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Swapica/indexer-svc/internal/amount"
+	"github.com/Swapica/indexer-svc/internal/store"
+	"github.com/Swapica/order-aggregator-svc/resources"
+)
+
+// listMatches serves GET /match_orders?filter[creator]=&filter[token_to_sell]=&filter[origin_order]=&filter[state]=
+func (h handler) listMatches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	q := r.URL.Query()
+	page, err := parsePage(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	state, err := parseState(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := store.MatchesFilter{
+		Creator:     q.Get("filter[creator]"),
+		TokenToSell: q.Get("filter[token_to_sell]"),
+		State:       state,
+	}
+	if raw := q.Get("filter[origin_order]"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid filter[origin_order]")
+			return
+		}
+		filter.OriginOrderID = &id
+	}
+
+	matches := h.store.Matches(filter, page)
+
+	resp := matchListResponse{
+		Data:  make([]match, len(matches)),
+		Links: pageLinks(r, page, len(matches)),
+	}
+	for i, m := range matches {
+		resp.Data[i] = newMatchModel(m, h.chainID)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// getMatch serves GET /match_orders/{id}, where id is the match ID from the contract
+func (h handler) getMatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	id, err := parseID(r, "/match_orders/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	m, ok := h.store.Match(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, matchResponse{Data: newMatchModel(m, h.chainID)})
+}
+
+// match is resources.Match with the normalized amount added to the attributes
+type match struct {
+	resources.Key
+	Attributes    matchAttributes              `json:"attributes"`
+	Relationships resources.MatchRelationships `json:"relationships"`
+}
+
+type matchAttributes struct {
+	resources.MatchAttributes
+	amount.Normalized
+}
+
+type matchResponse struct {
+	Data match `json:"data"`
+}
+
+type matchListResponse struct {
+	Data  []match          `json:"data"`
+	Links *resources.Links `json:"links"`
+}
+
+func newMatchModel(m store.Match, chainID int64) match {
+	return match{
+		Key: resources.NewKeyInt64(m.MatchID, resources.MATCH_ORDER),
+		Attributes: matchAttributes{
+			MatchAttributes: resources.MatchAttributes{
+				AmountToSell:  m.AmountToSell,
+				Creator:       m.Creator,
+				MatchId:       m.MatchID,
+				OriginOrderId: m.OriginOrderID,
+				State:         m.State,
+				UseRelayer:    m.UseRelayer,
+			},
+			Normalized: m.Normalized,
+		},
+		Relationships: resources.MatchRelationships{
+			SrcChain:    *resources.NewKeyInt64(chainID, resources.CHAIN).AsRelation(),
+			OriginChain: *resources.NewKeyInt64(m.OriginChain, resources.CHAIN).AsRelation(),
+			OriginOrder: *resources.NewKeyInt64(m.OriginOrderID, resources.ORDER).AsRelation(),
+			TokenToSell: *tokenKey(m.TokenToSell).AsRelation(),
+		},
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Swapica/indexer-svc/internal/amount"
+	"github.com/Swapica/indexer-svc/internal/store"
+	"github.com/Swapica/order-aggregator-svc/resources"
+)
+
+// listOrders serves GET /orders?filter[creator]=&filter[token_to_sell]=&filter[token_to_buy]=&filter[state]=
+func (h handler) listOrders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	q := r.URL.Query()
+	page, err := parsePage(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	state, err := parseState(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	orders := h.store.Orders(store.OrdersFilter{
+		Creator:     q.Get("filter[creator]"),
+		TokenToSell: q.Get("filter[token_to_sell]"),
+		TokenToBuy:  q.Get("filter[token_to_buy]"),
+		State:       state,
+	}, page)
+
+	resp := orderListResponse{
+		Data:  make([]order, len(orders)),
+		Links: pageLinks(r, page, len(orders)),
+	}
+	for i, o := range orders {
+		resp.Data[i] = newOrderModel(o, h.chainID)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// getOrder serves GET /orders/{id}, where id is the order ID from the contract
+func (h handler) getOrder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	id, err := parseID(r, "/orders/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	o, ok := h.store.Order(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, orderResponse{Data: newOrderModel(o, h.chainID)})
+}
+
+// order is resources.Order with the normalized amounts and the price added to
+// the attributes
+type order struct {
+	resources.Key
+	Attributes    orderAttributes              `json:"attributes"`
+	Relationships resources.OrderRelationships `json:"relationships"`
+}
+
+type orderAttributes struct {
+	resources.OrderAttributes
+	amount.Normalized
+}
+
+type orderResponse struct {
+	Data order `json:"data"`
+}
+
+type orderListResponse struct {
+	Data  []order          `json:"data"`
+	Links *resources.Links `json:"links"`
+}
+
+func newOrderModel(o store.Order, chainID int64) order {
+	model := order{
+		Key: resources.NewKeyInt64(o.OrderID, resources.ORDER),
+		Attributes: orderAttributes{
+			OrderAttributes: resources.OrderAttributes{
+				AmountToBuy:  o.AmountToBuy,
+				AmountToSell: o.AmountToSell,
+				Creator:      o.Creator,
+				MatchId:      o.MatchID,
+				MatchSwapica: o.MatchSwapica,
+				OrderId:      o.OrderID,
+				State:        o.State,
+				UseRelayer:   o.UseRelayer,
+			},
+			Normalized: o.Normalized,
+		},
+		Relationships: resources.OrderRelationships{
+			SrcChain:         *resources.NewKeyInt64(chainID, resources.CHAIN).AsRelation(),
+			DestinationChain: *resources.NewKeyInt64(o.DestinationChain, resources.CHAIN).AsRelation(),
+			TokenToSell:      *tokenKey(o.TokenToSell).AsRelation(),
+			TokenToBuy:       *tokenKey(o.TokenToBuy).AsRelation(),
+		},
+	}
+	if o.MatchID != nil {
+		model.Relationships.Match = resources.NewKeyInt64(*o.MatchID, resources.MATCH_ORDER).AsRelation()
+	}
+
+	return model
+}
+
+// tokenKey uses the token address as ID, because the indexer does not know
+// the collector token IDs
+func tokenKey(address string) resources.Key {
+	return resources.Key{ID: address, Type: resources.TOKEN}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Swapica/indexer-svc/internal/store"
+	"github.com/Swapica/order-aggregator-svc/resources"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+const (
+	defaultPageLimit = 15
+	maxPageLimit     = 100
+)
+
+func parsePage(q url.Values) (store.Page, error) {
+	page := store.Page{Limit: defaultPageLimit}
+
+	if raw := q.Get("page[number]"); raw != "" {
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return page, errors.Wrap(err, "invalid page[number]")
+		}
+		page.Number = n
+	}
+	if raw := q.Get("page[limit]"); raw != "" {
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil || n == 0 || n > maxPageLimit {
+			return page, errors.New("page[limit] must be from 1 to " + strconv.Itoa(maxPageLimit))
+		}
+		page.Limit = n
+	}
+
+	return page, nil
+}
+
+func parseState(q url.Values) (*uint8, error) {
+	raw := q.Get("filter[state]")
+	if raw == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseUint(raw, 10, 8)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid filter[state]")
+	}
+	s := uint8(n)
+	return &s, nil
+}
+
+// parseID parses the last path segment after prefix
+func parseID(r *http.Request, prefix string) (int64, error) {
+	raw := strings.TrimPrefix(r.URL.Path, prefix)
+	id, err := strconv.ParseInt(raw, 10, 64)
+	return id, errors.Wrap(err, "invalid id")
+}
+
+// pageLinks returns the next link only when the page is full, so an extra
+// empty page can be requested, but the total count is never computed
+func pageLinks(r *http.Request, page store.Page, size int) *resources.Links {
+	link := func(number uint64) string {
+		q := r.URL.Query()
+		q.Set("page[number]", strconv.FormatUint(number, 10))
+		q.Set("page[limit]", strconv.FormatUint(page.Limit, 10))
+		return r.URL.Path + "?" + q.Encode()
+	}
+
+	links := &resources.Links{Self: link(page.Number)}
+	if uint64(size) == page.Limit {
+		links.Next = link(page.Number + 1)
+	}
+	return links
+}
@@ -0,0 +1,245 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Swapica/indexer-svc/internal/calldata"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+const (
+	EntityOrder = "order"
+	EntityMatch = "match"
+)
+
+// Record is an archived create or update event of an order or a match. The
+// raw log is kept, so the events can be replayed through the handlers. The
+// record of a log removed by a chain reorganization is appended again with
+// Log.Removed set, and the log is dropped from the archive.
+type Record struct {
+	ChainID  int64  `json:"chain_id"`
+	Entity   string `json:"entity"`
+	ID       int64  `json:"id"`
+	Event    string `json:"event"`
+	State    string `json:"state"`
+	Block    uint64 `json:"block"`
+	TxHash   string `json:"tx_hash"`
+	LogIndex uint   `json:"log_index"`
+	// Tx is nil when the transaction could not be fetched
+	Tx         *calldata.Tx `json:"tx,omitempty"`
+	RecordedAt time.Time    `json:"recorded_at"`
+	Log        types.Log    `json:"log"`
+}
+
+func (r Record) before(other Record) bool {
+	return r.Block < other.Block || r.Block == other.Block && r.LogIndex < other.LogIndex
+}
+
+type entityKey struct {
+	chainID int64
+	entity  string
+	id      int64
+}
+
+// position includes the block hash, so the log of the block replaced by a
+// reorganization is archived again
+type position struct {
+	chainID   int64
+	blockHash common.Hash
+	logIndex  uint
+}
+
+func (r Record) position() position {
+	return position{r.ChainID, r.Log.BlockHash, r.LogIndex}
+}
+
+// Archive is an append-only JSONL file of the events, indexed in memory by
+// entity. Every log is archived once, no matter how many times it is applied.
+type Archive struct {
+	mu       sync.RWMutex
+	file     *os.File
+	records  []Record
+	byEntity map[entityKey][]int
+	// seen points to the records of the logs not removed
+	seen    map[position]int
+	removed map[int]struct{}
+}
+
+// Open loads the archive, the file is created when missing. The last record
+// torn by an interrupted write is truncated, so the next one starts on its own
+// line.
+func Open(path string) (*Archive, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open archive", logan.F{"path": path})
+	}
+
+	a := &Archive{
+		file:     file,
+		byEntity: make(map[entityKey][]int),
+		seen:     make(map[position]int),
+		removed:  make(map[int]struct{}),
+	}
+	if err = a.load(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *Archive) load() error {
+	r := bufio.NewReader(a.file)
+	var offset int64
+	for line := 1; ; line++ {
+		raw, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(raw) == 0 {
+				return nil
+			}
+			return a.truncate(offset, line)
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read archive")
+		}
+
+		var rec Record
+		if err = json.Unmarshal(raw, &rec); err != nil {
+			return errors.Wrap(err, "failed to unmarshal archive record", logan.F{"line": line})
+		}
+		a.index(rec)
+		offset += int64(len(raw))
+	}
+}
+
+// truncate drops the record without the line end, it is torn even when it is
+// a valid JSON. The checkpoint is saved after the archive, so the event is
+// archived again when it is replayed.
+func (a *Archive) truncate(offset int64, line int) error {
+	if err := a.file.Truncate(offset); err != nil {
+		return errors.Wrap(err, "failed to truncate torn archive record", logan.F{"line": line})
+	}
+	return nil
+}
+
+// Has reports whether the log is already archived
+func (a *Archive) Has(chainID int64, log types.Log) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	_, ok := a.seen[position{chainID, log.BlockHash, log.Index}]
+	return ok
+}
+
+// Append writes the record unless the log is already archived
+func (a *Archive) Append(rec Record) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.seen[rec.position()]; ok {
+		return nil
+	}
+	return a.write(rec)
+}
+
+// Remove drops the log removed by a chain reorganization, it is no-op when the
+// log is not archived
+func (a *Archive) Remove(chainID int64, log types.Log) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i, ok := a.seen[position{chainID, log.BlockHash, log.Index}]
+	if !ok {
+		return nil
+	}
+	rec := a.records[i]
+	rec.Log.Removed, rec.RecordedAt = true, time.Now().UTC()
+	return a.write(rec)
+}
+
+// write must be called with the lock held
+func (a *Archive) write(rec Record) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal archive record")
+	}
+	if _, err = a.file.Write(append(raw, '\n')); err != nil {
+		return errors.Wrap(err, "failed to write archive record")
+	}
+
+	a.index(rec)
+	return nil
+}
+
+// Close syncs the file to the disk and closes it
+func (a *Archive) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.file.Sync(); err != nil {
+		_ = a.file.Close()
+		return errors.Wrap(err, "failed to sync archive")
+	}
+	return errors.Wrap(a.file.Close(), "failed to close archive")
+}
+
+// index must be called with the lock held
+func (a *Archive) index(rec Record) {
+	pos := rec.position()
+	if rec.Log.Removed {
+		if i, ok := a.seen[pos]; ok {
+			a.removed[i] = struct{}{}
+			delete(a.seen, pos)
+		}
+		return
+	}
+
+	a.seen[pos] = len(a.records)
+	key := entityKey{rec.ChainID, rec.Entity, rec.ID}
+	a.byEntity[key] = append(a.byEntity[key], len(a.records))
+	a.records = append(a.records, rec)
+}
+
+// History returns the events of the entity in the chain order
+func (a *Archive) History(chainID int64, entity string, id int64) []Record {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	idx := a.byEntity[entityKey{chainID, entity, id}]
+	result := make([]Record, 0, len(idx))
+	for _, i := range idx {
+		if _, ok := a.removed[i]; !ok {
+			result = append(result, a.records[i])
+		}
+	}
+	sortRecords(result)
+	return result
+}
+
+// Records returns all the events of the chain in the chain order
+func (a *Archive) Records(chainID int64) []Record {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	result := make([]Record, 0)
+	for i, rec := range a.records {
+		if _, ok := a.removed[i]; !ok && rec.ChainID == chainID {
+			result = append(result, rec)
+		}
+	}
+	sortRecords(result)
+	return result
+}
+
+func sortRecords(records []Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].before(records[j])
+	})
+}
@@ -0,0 +1,155 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func newRecord(id int64, block uint64, blockHash byte, index uint) Record {
+	return Record{
+		ChainID:  5,
+		Entity:   EntityOrder,
+		ID:       id,
+		Event:    "OrderCreated",
+		Block:    block,
+		LogIndex: index,
+		Log: types.Log{
+			Topics:      []common.Hash{{}},
+			BlockNumber: block,
+			BlockHash:   common.Hash{blockHash},
+			Index:       index,
+		},
+	}
+}
+
+func TestOpenTruncatesTornRecord(t *testing.T) {
+	cases := []struct {
+		name    string
+		tail    string
+		records int
+	}{
+		{name: "complete", tail: "", records: 2},
+		{name: "torn json", tail: `{"chain_id":5,"entity":"or`, records: 2},
+		{name: "valid json without line end", tail: `{"chain_id":5}`, records: 2},
+	}
+	for _, c := range cases {
+		path := filepath.Join(t.TempDir(), "archive.jsonl")
+		a, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, rec := range []Record{newRecord(1, 10, 1, 0), newRecord(2, 11, 2, 0)} {
+			if err = a.Append(rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = a.Close(); err != nil {
+			t.Fatal(err)
+		}
+		size := fileSize(t, path)
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.WriteString(c.tail); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+
+		a, err = Open(path)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got := len(a.Records(5)); got != c.records {
+			t.Errorf("%s: got %d records, want %d", c.name, got, c.records)
+		}
+		if got := fileSize(t, path); got != size {
+			t.Errorf("%s: got file size %d, want %d", c.name, got, size)
+		}
+
+		// the next record starts on its own line
+		if err = a.Append(newRecord(3, 12, 3, 0)); err != nil {
+			t.Fatal(err)
+		}
+		_ = a.Close()
+		if a, err = Open(path); err != nil {
+			t.Fatalf("%s: failed to open after append: %v", c.name, err)
+		}
+		if got := len(a.Records(5)); got != c.records+1 {
+			t.Errorf("%s: got %d records after append, want %d", c.name, got, c.records+1)
+		}
+		_ = a.Close()
+	}
+}
+
+func TestArchiveReorg(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.jsonl")
+	a, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orphaned := newRecord(1, 10, 1, 0)
+	replaced := newRecord(1, 10, 2, 0)
+
+	if err = a.Append(orphaned); err != nil {
+		t.Fatal(err)
+	}
+	// the same log is archived once
+	if err = a.Append(orphaned); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Has(5, orphaned.Log) || a.Has(5, replaced.Log) {
+		t.Fatal("log of another block with the same position is treated as archived")
+	}
+
+	removed := orphaned.Log
+	removed.Removed = true
+	if err = a.Remove(5, removed); err != nil {
+		t.Fatal(err)
+	}
+	if a.Has(5, orphaned.Log) {
+		t.Error("removed log is still archived")
+	}
+	if err = a.Append(replaced); err != nil {
+		t.Fatal(err)
+	}
+	// removing the unknown log is no-op
+	if err = a.Remove(5, newRecord(9, 20, 9, 0).Log); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for name, got := range map[string][]Record{
+		"records": a.Records(5),
+		"history": a.History(5, EntityOrder, 1),
+	} {
+		if len(got) != 1 || got[0].Log.BlockHash != replaced.Log.BlockHash {
+			t.Errorf("%s: got %+v, want only the record of the new block", name, got)
+		}
+	}
+	if a.Has(5, orphaned.Log) || !a.Has(5, replaced.Log) {
+		t.Error("removal is not restored from the file")
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
@@ -0,0 +1,50 @@
+package calldata
+
+import (
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// Tx describes the transaction which emitted the event
+type Tx struct {
+	Sender string `json:"sender"`
+	// Method is empty when the transaction did not call the contract directly,
+	// e.g. it was sent through a multisig
+	Method string `json:"method,omitempty"`
+	// ByRelayer is set only when the relayer addresses are configured
+	ByRelayer *bool  `json:"by_relayer,omitempty"`
+	GasUsed   uint64 `json:"gas_used"`
+	// Signatures is the number of the signers signatures passed to the methods
+	// accepting (data, signatures)
+	Signatures int `json:"signatures"`
+}
+
+// Decode returns the contract method called by the input and the number of
+// signatures passed to it
+func Decode(contract abi.ABI, input []byte) (method string, signatures int, err error) {
+	if len(input) < 4 {
+		return "", 0, errors.New("input is too short")
+	}
+
+	m, err := contract.MethodById(input[:4])
+	if err != nil {
+		return "", 0, errors.Wrap(err, "unknown method")
+	}
+
+	args, err := m.Inputs.Unpack(input[4:])
+	if err != nil {
+		return "", 0, errors.Wrap(err, "failed to unpack input", logan.F{"method": m.Name})
+	}
+
+	for i, arg := range m.Inputs {
+		if arg.Name != "signatures" {
+			continue
+		}
+		if sigs, ok := args[i].([][]byte); ok {
+			signatures = len(sigs)
+		}
+	}
+
+	return m.Name, signatures, nil
+}
@@ -0,0 +1,61 @@
+package calldata
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+const testABI = `[
+	{"type":"function","name":"executeOrder","inputs":[{"name":"data","type":"bytes"},{"name":"signatures","type":"bytes[]"}],"outputs":[]},
+	{"type":"function","name":"cancelOrder","inputs":[{"name":"orderId","type":"uint256"}],"outputs":[]}
+]`
+
+func TestDecode(t *testing.T) {
+	contract, err := abi.JSON(strings.NewReader(testABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pack := func(method string, args ...interface{}) []byte {
+		input, err := contract.Pack(method, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return input
+	}
+	sigs := [][]byte{{1}, {2}, {3}}
+
+	cases := []struct {
+		name       string
+		input      []byte
+		method     string
+		signatures int
+		err        bool
+	}{
+		{name: "with signatures", input: pack("executeOrder", []byte{0xaa}, sigs), method: "executeOrder", signatures: 3},
+		{name: "empty signatures", input: pack("executeOrder", []byte{0xaa}, [][]byte{}), method: "executeOrder"},
+		{name: "without signatures", input: pack("cancelOrder", big.NewInt(1)), method: "cancelOrder"},
+		{name: "empty", input: nil, err: true},
+		{name: "too short", input: []byte{1, 2, 3}, err: true},
+		{name: "unknown method", input: []byte{0xde, 0xad, 0xbe, 0xef}, err: true},
+		{name: "truncated arguments", input: pack("executeOrder", []byte{0xaa}, sigs)[:40], err: true},
+	}
+	for _, c := range cases {
+		method, signatures, err := Decode(contract, c.input)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: Decode = %q, %d, want error", c.name, method, signatures)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Decode failed: %v", c.name, err)
+			continue
+		}
+		if method != c.method || signatures != c.signatures {
+			t.Errorf("%s: Decode = %q, %d, want %q, %d", c.name, method, signatures, c.method, c.signatures)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package cli
 
 import (
+	"os"
+	"strconv"
+
 	"github.com/Swapica/indexer-svc/internal/config"
 	"github.com/Swapica/indexer-svc/internal/service"
 	"github.com/alecthomas/kingpin"
@@ -24,6 +27,48 @@ func Run(args []string) bool {
 
 	runCmd := app.Command("run", "run command")
 	serviceCmd := runCmd.Command("service", "run service") // you can insert custom help
+	serviceDryRun := serviceCmd.Flag("dry-run", "skip the collector writes, see sink.dry_run").Bool()
+
+	statusCmd := app.Command("status", "show indexing lag and health of the chain")
+	statusJSON := statusCmd.Flag("json", "print status in JSON").Bool()
+
+	verifyCmd := app.Command("verify", "compare collector state with the contract")
+	verifyFix := verifyCmd.Flag("fix", "push contract state to the collector, missing entities are added only with --check-relayer").Bool()
+	verifyRelayer := verifyCmd.Flag("check-relayer", "compare use_relayer flags scanning creation events").Bool()
+	verifyEventsFrom := verifyCmd.Flag("events-from", "first block to scan creation events from").Uint64()
+
+	resyncCmd := app.Command("resync", "rewrite a single collector record with the contract state")
+	resyncFromBlock := resyncCmd.Flag("from-block", "first block to look for the update events and the creation of a missing entity from").Required().Uint64()
+	resyncOrderCmd := resyncCmd.Command("order", "resync order")
+	resyncOrderID := resyncOrderCmd.Arg("id", "order ID from the contract").Required().Int64()
+	resyncMatchCmd := resyncCmd.Command("match", "resync match")
+	resyncMatchID := resyncMatchCmd.Arg("id", "match ID from the contract").Required().Int64()
+
+	exportCmd := app.Command("export", "export orders and matches from the chain events")
+	exportChain := exportCmd.Flag("chain", "chain ID, must match network.chain_id").Int64()
+	exportFromBlock := exportCmd.Flag("from-block", "first block of the range").Uint64()
+	exportToBlock := exportCmd.Flag("to-block", "last block of the range, chain head by default").String()
+	exportFormat := exportCmd.Flag("format", "output format").Default(service.FormatCSV).
+		Enum(service.FormatCSV, service.FormatJSONL)
+
+	historyCmd := app.Command("history", "show archived events of a single order or match")
+	historyOrderCmd := historyCmd.Command("order", "order history")
+	historyOrderID := historyOrderCmd.Arg("id", "order ID from the contract").Required().Int64()
+	historyMatchCmd := historyCmd.Command("match", "match history")
+	historyMatchID := historyMatchCmd.Arg("id", "match ID from the contract").Required().Int64()
+
+	rebuildCmd := app.Command("rebuild", "reset chain data in the collector with DELETE {chain}/orders and DELETE {chain}/match_orders, then replay the archived events")
+	rebuildChain := rebuildCmd.Flag("chain", "chain ID, must match network.chain_id").Required().Int64()
+	rebuildYes := rebuildCmd.Flag("yes", "confirm deleting the chain orders and matches before the replay").Bool()
+
+	shadowCmd := app.Command("shadow", "process the chain events without writing to the collector and compare the writes with the recorded ones")
+	shadowExpected := shadowCmd.Flag("expected", "writes recorded by the production indexer, see sink.record").Required().String()
+	shadowOutput := shadowCmd.Flag("output", "file to record the shadow writes to").Default("./shadow-writes.jsonl").String()
+	shadowFromBlock := shadowCmd.Flag("from-block", "first block to read the events from when the archive is disabled").String()
+	shadowToBlock := shadowCmd.Flag("to-block", "last block to process, the last expected write block by default").String()
+
+	crossCheckCmd := app.Command("crosscheck", "check that orders and matches of different chains agree")
+	crossCheckChains := crossCheckCmd.Flag("chain", "chain ID to check, may be repeated, all collector chains by default").Int64List()
 
 	cmd, err := app.Parse(args[1:])
 	if err != nil {
@@ -33,7 +78,88 @@ func Run(args []string) bool {
 
 	switch cmd {
 	case serviceCmd.FullCommand():
-		service.Run(cfg)
+		if err := service.Run(cfg, *serviceDryRun); err != nil {
+			log.WithError(err).Error("service failed")
+			return false
+		}
+	case statusCmd.FullCommand():
+		if err := service.PrintStatus(cfg, os.Stdout, *statusJSON); err != nil {
+			log.WithError(err).Error("failed to print status")
+			return false
+		}
+	case verifyCmd.FullCommand():
+		opts := service.VerifyOpts{Fix: *verifyFix}
+		if *verifyRelayer {
+			opts.EventsFrom = verifyEventsFrom
+		}
+		ok, err := service.Verify(cfg, os.Stdout, opts)
+		if err != nil {
+			log.WithError(err).Error("failed to verify")
+			return false
+		}
+		return ok
+	case resyncOrderCmd.FullCommand():
+		if err := service.Resync(cfg, os.Stdout, service.EntityOrder, *resyncOrderID, *resyncFromBlock); err != nil {
+			log.WithError(err).Error("failed to resync order")
+			return false
+		}
+	case resyncMatchCmd.FullCommand():
+		if err := service.Resync(cfg, os.Stdout, service.EntityMatch, *resyncMatchID, *resyncFromBlock); err != nil {
+			log.WithError(err).Error("failed to resync match")
+			return false
+		}
+	case exportCmd.FullCommand():
+		opts := service.ExportOpts{
+			ChainID:   *exportChain,
+			FromBlock: *exportFromBlock,
+			Format:    *exportFormat,
+		}
+		if opts.ToBlock, err = parseOptBlock(*exportToBlock); err != nil {
+			log.WithError(err).Error("failed to parse to-block")
+			return false
+		}
+		if err := service.Export(cfg, os.Stdout, opts); err != nil {
+			log.WithError(err).Error("failed to export")
+			return false
+		}
+	case historyOrderCmd.FullCommand():
+		if err := service.PrintHistory(cfg, os.Stdout, service.EntityOrder, *historyOrderID); err != nil {
+			log.WithError(err).Error("failed to print order history")
+			return false
+		}
+	case historyMatchCmd.FullCommand():
+		if err := service.PrintHistory(cfg, os.Stdout, service.EntityMatch, *historyMatchID); err != nil {
+			log.WithError(err).Error("failed to print match history")
+			return false
+		}
+	case rebuildCmd.FullCommand():
+		if err := service.Rebuild(cfg, os.Stdout, *rebuildChain, *rebuildYes); err != nil {
+			log.WithError(err).Error("failed to rebuild chain")
+			return false
+		}
+	case shadowCmd.FullCommand():
+		opts := service.ShadowOpts{Expected: *shadowExpected, Output: *shadowOutput}
+		if opts.FromBlock, err = parseOptBlock(*shadowFromBlock); err != nil {
+			log.WithError(err).Error("failed to parse from-block")
+			return false
+		}
+		if opts.ToBlock, err = parseOptBlock(*shadowToBlock); err != nil {
+			log.WithError(err).Error("failed to parse to-block")
+			return false
+		}
+		ok, err := service.Shadow(cfg, os.Stdout, opts)
+		if err != nil {
+			log.WithError(err).Error("failed to run shadow")
+			return false
+		}
+		return ok
+	case crossCheckCmd.FullCommand():
+		ok, err := service.CrossCheck(cfg, os.Stdout, *crossCheckChains)
+		if err != nil {
+			log.WithError(err).Error("failed to cross-check chains")
+			return false
+		}
+		return ok
 	default:
 		log.Errorf("unknown command %s", cmd)
 		return false
@@ -41,3 +167,15 @@ func Run(args []string) bool {
 
 	return true
 }
+
+// parseOptBlock returns nil for the empty string
+func parseOptBlock(s string) (*uint64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
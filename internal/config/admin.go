@@ -0,0 +1,29 @@
+package config
+
+import (
+	"gitlab.com/distributed_lab/figure/v3"
+	"gitlab.com/distributed_lab/kit/kv"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// Admin configures the HTTP server with admin endpoints and metrics, the
+// server is disabled when Addr is empty. The requests other than GET must
+// carry the Token, they are refused when it is empty.
+type Admin struct {
+	Addr  string `fig:"addr"`
+	Token string `fig:"token"`
+}
+
+func (c *config) Admin() Admin {
+	return c.adminOnce.Do(func() interface{} {
+		var cfg Admin
+		err := figure.Out(&cfg).
+			From(kv.MustGetStringMap(c.getter, "admin")).
+			Please()
+		if err != nil {
+			panic(errors.Wrap(err, "failed to figure out admin"))
+		}
+
+		return cfg
+	}).(Admin)
+}
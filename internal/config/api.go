@@ -0,0 +1,31 @@
+package config
+
+import (
+	"gitlab.com/distributed_lab/figure/v3"
+	"gitlab.com/distributed_lab/kit/kv"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// API configures the read-only query API served from the local store, the
+// API is disabled when Addr is empty
+type API struct {
+	Addr string `fig:"addr"`
+}
+
+func (c *config) API() API {
+	return c.apiOnce.Do(func() interface{} {
+		var cfg API
+		err := figure.Out(&cfg).
+			From(kv.MustGetStringMap(c.getter, "api")).
+			Please()
+		if err != nil {
+			panic(errors.Wrap(err, "failed to figure out api"))
+		}
+
+		if cfg.Addr != "" && c.LocalStore() == nil {
+			panic(errors.New("api requires the local store to be enabled"))
+		}
+
+		return cfg
+	}).(API)
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"github.com/Swapica/indexer-svc/internal/archive"
+	"gitlab.com/distributed_lab/figure/v3"
+	"gitlab.com/distributed_lab/kit/kv"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// EventArchive returns nil when the archive is disabled
+func (c *config) EventArchive() *archive.Archive {
+	return c.archiveOnce.Do(func() interface{} {
+		var cfg struct {
+			Path string `fig:"path"`
+		}
+		err := figure.Out(&cfg).
+			From(kv.MustGetStringMap(c.getter, "archive")).
+			Please()
+		if err != nil {
+			panic(errors.Wrap(err, "failed to figure out archive"))
+		}
+
+		if cfg.Path == "" {
+			return (*archive.Archive)(nil)
+		}
+
+		a, err := archive.Open(cfg.Path)
+		if err != nil {
+			panic(errors.Wrap(err, "failed to open event archive"))
+		}
+		return a
+	}).(*archive.Archive)
+}
@@ -5,18 +5,21 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/Swapica/indexer-svc/internal/retry"
+	"github.com/Swapica/indexer-svc/internal/sink"
 	"gitlab.com/distributed_lab/figure/v3"
-	jsonapi "gitlab.com/distributed_lab/json-api-connector"
 	"gitlab.com/distributed_lab/kit/kv"
 	"gitlab.com/distributed_lab/logan/v3/errors"
 	"gitlab.com/tokend/connectors/signed"
 )
 
-func (c *config) Collector() *jsonapi.Connector {
+func (c *config) Collector() sink.Collector {
 	return c.collectorOnce.Do(func() interface{} {
 		var cfg struct {
-			Endpoint       *url.URL      `fig:"endpoint,required"`
-			RequestTimeout time.Duration `fig:"request_timeout"`
+			Endpoint        *url.URL      `fig:"endpoint,required"`
+			RequestTimeout  time.Duration `fig:"request_timeout"`
+			RequestAttempts int           `fig:"request_attempts"`
+			RetryPeriod     time.Duration `fig:"retry_period"`
 		}
 		err := figure.Out(&cfg).
 			From(kv.MustGetStringMap(c.getter, "collector")).
@@ -28,7 +31,18 @@ func (c *config) Collector() *jsonapi.Connector {
 		if cfg.RequestTimeout == 0 {
 			cfg.RequestTimeout = defaultRequestTimeout
 		}
+		if cfg.RequestAttempts == 0 {
+			cfg.RequestAttempts = defaultRequestAttempts
+		}
+		if cfg.RetryPeriod == 0 {
+			cfg.RetryPeriod = defaultRetryPeriod
+		}
 
-		return jsonapi.NewConnector(signed.NewClient(&http.Client{Timeout: cfg.RequestTimeout}, cfg.Endpoint))
-	}).(*jsonapi.Connector)
+		// The timeout is applied by the budget, so the client has none
+		return sink.NewClient(signed.NewClient(&http.Client{}, cfg.Endpoint), retry.Budget{
+			Timeout:  cfg.RequestTimeout,
+			Attempts: cfg.RequestAttempts,
+			Period:   cfg.RetryPeriod,
+		})
+	}).(sink.Collector)
 }
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"time"
+
+	"gitlab.com/distributed_lab/figure/v3"
+	"gitlab.com/distributed_lab/kit/kv"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// CrossCheck configures the periodic check of orders and matches across the
+// chains of the collector, the check is disabled when Period is zero
+type CrossCheck struct {
+	Period time.Duration `fig:"period"`
+	// Chains to check, all the chains of the collector are checked when empty
+	Chains []int64 `fig:"chains"`
+}
+
+func (c *config) CrossCheck() CrossCheck {
+	return c.crossCheckOnce.Do(func() interface{} {
+		var cfg CrossCheck
+		err := figure.Out(&cfg).
+			From(kv.MustGetStringMap(c.getter, "crosscheck")).
+			Please()
+		if err != nil {
+			panic(errors.Wrap(err, "failed to figure out crosscheck"))
+		}
+
+		return cfg
+	}).(CrossCheck)
+}
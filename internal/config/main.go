@@ -1,7 +1,10 @@
 package config
 
 import (
-	jsonapi "gitlab.com/distributed_lab/json-api-connector"
+	"github.com/Swapica/indexer-svc/internal/archive"
+	"github.com/Swapica/indexer-svc/internal/relayer"
+	"github.com/Swapica/indexer-svc/internal/sink"
+	"github.com/Swapica/indexer-svc/internal/store"
 	"gitlab.com/distributed_lab/kit/comfig"
 	"gitlab.com/distributed_lab/kit/kv"
 )
@@ -10,15 +13,31 @@ type Config interface {
 	comfig.Logger
 
 	Network() Network
-	Collector() *jsonapi.Connector
+	Collector() sink.Collector
+	Admin() Admin
+	LocalStore() *store.Store
+	API() API
+	Webhooks() Webhooks
+	CrossCheck() CrossCheck
+	RelayerQueue() relayer.Queue
+	EventArchive() *archive.Archive
+	Sink() Sink
 }
 
 type config struct {
 	comfig.Logger
 	getter kv.Getter
 
-	networkOnce   comfig.Once
-	collectorOnce comfig.Once
+	networkOnce    comfig.Once
+	collectorOnce  comfig.Once
+	adminOnce      comfig.Once
+	storeOnce      comfig.Once
+	apiOnce        comfig.Once
+	webhooksOnce   comfig.Once
+	crossCheckOnce comfig.Once
+	relayerOnce    comfig.Once
+	archiveOnce    comfig.Once
+	sinkOnce       comfig.Once
 }
 
 func New(getter kv.Getter) Config {
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/Swapica/indexer-svc/internal/gobind"
+	"github.com/Swapica/indexer-svc/internal/retry"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"gitlab.com/distributed_lab/figure/v3"
@@ -17,28 +18,61 @@ type Network struct {
 	ContractAddress   common.Address
 	EthClient         *ethclient.Client
 	WsClient          *ethclient.Client
+	HybridMode        bool
 	ChainID           int64
 	IndexPeriod       time.Duration
 	BlockRange        uint64
 	OverrideLastBlock uint64
+	StartTime         *time.Time
 	RequestTimeout    time.Duration
+	StallTimeout      time.Duration
+	MaxLagBlocks      uint64
+	// OriginWaitTimeout is how long a match is held until its origin order
+	// from another chain appears in the collector
+	OriginWaitTimeout time.Duration
+	// OriginFallback enables looking up the origin order in the contract of
+	// its chain after OriginWaitTimeout, the match is held until it is found
+	OriginFallback bool
+	// Relayers are the addresses the relayer sends the transactions from
+	Relayers []common.Address
+	// ShutdownGrace is how long the writes in progress may take after the
+	// shutdown signal
+	ShutdownGrace time.Duration
+	// Retry is the budget of every RPC call, its timeout is RequestTimeout
+	Retry retry.Budget
 }
 
 const defaultRequestTimeout = 10 * time.Second
+const defaultRequestAttempts = 3
+const defaultRetryPeriod = time.Second
+const defaultStallTimeout = 5 * time.Minute
+const defaultMaxLagBlocks = 50
+const defaultOriginWaitTimeout = 5 * time.Minute
+const defaultShutdownGrace = 30 * time.Second
 const maxChainID int64 = math.MaxUint64/2 - 36
 
 func (c *config) Network() Network {
 	return c.networkOnce.Do(func() interface{} {
 		var cfg struct {
-			RPC               string         `fig:"rpc,required"`
-			Contract          common.Address `fig:"contract,required"`
-			ChainID           int64          `fig:"chain_id,required"`
-			UseWs             bool           `fig:"use_websocket,required"`
-			IndexPeriod       time.Duration  `fig:"index_period,required"`
-			BlockRange        uint64         `fig:"block_range"`
-			OverrideLastBlock uint64         `fig:"override_last_block"`
-			RequestTimeout    time.Duration  `fig:"request_timeout"`
-			WS                string         `fig:"ws,required"`
+			RPC               string           `fig:"rpc,required"`
+			Contract          common.Address   `fig:"contract,required"`
+			ChainID           int64            `fig:"chain_id,required"`
+			UseWs             bool             `fig:"use_websocket,required"`
+			HybridMode        bool             `fig:"hybrid_mode"`
+			IndexPeriod       time.Duration    `fig:"index_period,required"`
+			BlockRange        uint64           `fig:"block_range"`
+			OverrideLastBlock uint64           `fig:"override_last_block"`
+			StartTime         *time.Time       `fig:"start_time"`
+			RequestTimeout    time.Duration    `fig:"request_timeout"`
+			RequestAttempts   int              `fig:"request_attempts"`
+			RetryPeriod       time.Duration    `fig:"retry_period"`
+			StallTimeout      time.Duration    `fig:"stall_timeout"`
+			MaxLagBlocks      uint64           `fig:"max_lag_blocks"`
+			OriginWaitTimeout *time.Duration   `fig:"origin_wait_timeout"`
+			OriginFallback    bool             `fig:"origin_fallback"`
+			Relayers          []common.Address `fig:"relayers"`
+			ShutdownGrace     time.Duration    `fig:"shutdown_grace"`
+			WS                string           `fig:"ws,required"`
 		}
 
 		err := figure.Out(&cfg).
@@ -64,6 +98,30 @@ func (c *config) Network() Network {
 		if cfg.RequestTimeout == 0 {
 			cfg.RequestTimeout = defaultRequestTimeout
 		}
+		if cfg.RequestAttempts == 0 {
+			cfg.RequestAttempts = defaultRequestAttempts
+		}
+		if cfg.RetryPeriod == 0 {
+			cfg.RetryPeriod = defaultRetryPeriod
+		}
+		if cfg.StallTimeout == 0 {
+			cfg.StallTimeout = defaultStallTimeout
+		}
+		if cfg.MaxLagBlocks == 0 {
+			cfg.MaxLagBlocks = defaultMaxLagBlocks
+		}
+		if cfg.ShutdownGrace == 0 {
+			cfg.ShutdownGrace = defaultShutdownGrace
+		}
+
+		if cfg.OriginWaitTimeout == nil {
+			timeout := defaultOriginWaitTimeout
+			cfg.OriginWaitTimeout = &timeout
+		}
+
+		if cfg.HybridMode && !cfg.UseWs {
+			panic("hybrid_mode requires use_websocket to be enabled")
+		}
 
 		var wsCli *ethclient.Client
 		if cfg.UseWs {
@@ -73,16 +131,33 @@ func (c *config) Network() Network {
 			}
 		}
 
+		if err = checkNetwork(cfg.ChainID, cfg.Contract, cli, wsCli, cfg.RequestTimeout); err != nil {
+			panic(errors.Wrap(err, "network sanity check failed"))
+		}
+
 		return Network{
 			Swapica:           s,
 			ContractAddress:   cfg.Contract,
 			EthClient:         cli,
 			WsClient:          wsCli,
+			HybridMode:        cfg.HybridMode,
 			ChainID:           cfg.ChainID,
 			IndexPeriod:       cfg.IndexPeriod,
 			BlockRange:        cfg.BlockRange,
 			OverrideLastBlock: cfg.OverrideLastBlock,
+			StartTime:         cfg.StartTime,
 			RequestTimeout:    cfg.RequestTimeout,
+			StallTimeout:      cfg.StallTimeout,
+			MaxLagBlocks:      cfg.MaxLagBlocks,
+			OriginWaitTimeout: *cfg.OriginWaitTimeout,
+			OriginFallback:    cfg.OriginFallback,
+			Relayers:          cfg.Relayers,
+			ShutdownGrace:     cfg.ShutdownGrace,
+			Retry: retry.Budget{
+				Timeout:  cfg.RequestTimeout,
+				Attempts: cfg.RequestAttempts,
+				Period:   cfg.RetryPeriod,
+			},
 		}
 	}).(Network)
 }
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/Swapica/indexer-svc/internal/gobind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// implementationSlot is the ERC-1967 storage slot of the proxy implementation
+// address, it is also returned by proxiableUUID of the UUPS implementation
+var implementationSlot = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+
+// checkNetwork verifies that RPC, websocket and the contract belong to the
+// configured chain, so the misconfigured service fails on start
+func checkNetwork(chainID int64, contract common.Address, cli, wsCli *ethclient.Client, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := checkChainID(ctx, "rpc", cli, chainID); err != nil {
+		return err
+	}
+	if wsCli != nil {
+		if err := checkChainID(ctx, "ws", wsCli, chainID); err != nil {
+			return err
+		}
+	}
+
+	code, err := cli.CodeAt(ctx, contract, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to get contract code")
+	}
+	if len(code) == 0 {
+		return errors.From(errors.New("no contract code at the configured address"), logan.F{
+			"contract": contract.Hex(),
+		})
+	}
+
+	swapica, err := gobind.NewSwapicaCaller(contract, cli)
+	if err != nil {
+		return errors.Wrap(err, "failed to create contract caller")
+	}
+	if _, err = swapica.Owner(&bind.CallOpts{Context: ctx}); err != nil {
+		return errors.Wrap(err, "failed to call owner(), contract is not Swapica", logan.F{
+			"contract": contract.Hex(),
+		})
+	}
+
+	slot, err := cli.StorageAt(ctx, contract, implementationSlot, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to get proxy implementation slot")
+	}
+	implementation := common.BytesToAddress(slot)
+	if implementation == (common.Address{}) {
+		return errors.From(errors.New("contract is not an ERC-1967 proxy"), logan.F{
+			"contract": contract.Hex(),
+		})
+	}
+
+	impl, err := gobind.NewSwapicaCaller(implementation, cli)
+	if err != nil {
+		return errors.Wrap(err, "failed to create implementation caller")
+	}
+	uuid, err := impl.ProxiableUUID(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return errors.Wrap(err, "failed to call proxiableUUID() on implementation", logan.F{
+			"implementation": implementation.Hex(),
+		})
+	}
+	if common.Hash(uuid) != implementationSlot {
+		return errors.From(errors.New("implementation is not UUPS proxiable"), logan.F{
+			"implementation": implementation.Hex(),
+			"proxiable_uuid": common.Hash(uuid).Hex(),
+		})
+	}
+
+	return nil
+}
+
+func checkChainID(ctx context.Context, name string, cli *ethclient.Client, expected int64) error {
+	actual, err := cli.ChainID(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get chain id", logan.F{"client": name})
+	}
+	if actual.Cmp(big.NewInt(expected)) != 0 {
+		return errors.From(errors.New("chain id of the provider does not match chain_id"), logan.F{
+			"client":   name,
+			"expected": expected,
+			"actual":   actual.String(),
+		})
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"github.com/Swapica/indexer-svc/internal/relayer"
+	"gitlab.com/distributed_lab/figure/v3"
+	"gitlab.com/distributed_lab/kit/kv"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+const (
+	relayerQueueMemory = "memory"
+	relayerQueueFile   = "file"
+)
+
+// RelayerQueue returns nil when the relayer jobs are disabled
+func (c *config) RelayerQueue() relayer.Queue {
+	return c.relayerOnce.Do(func() interface{} {
+		var cfg struct {
+			Queue string `fig:"queue"`
+			Dir   string `fig:"dir"`
+		}
+		err := figure.Out(&cfg).
+			From(kv.MustGetStringMap(c.getter, "relayer")).
+			Please()
+		if err != nil {
+			panic(errors.Wrap(err, "failed to figure out relayer"))
+		}
+
+		switch cfg.Queue {
+		case "":
+			return relayer.Queue(nil)
+		case relayerQueueMemory:
+			return relayer.Queue(relayer.NewMemoryQueue())
+		case relayerQueueFile:
+			if cfg.Dir == "" {
+				panic(errors.New("relayer dir is required for the file queue"))
+			}
+			q, err := relayer.NewFileQueue(cfg.Dir)
+			if err != nil {
+				panic(errors.Wrap(err, "failed to open relayer queue"))
+			}
+			return relayer.Queue(q)
+		default:
+			panic(errors.From(errors.New("unknown relayer queue"), logan.F{"queue": cfg.Queue}))
+		}
+	}).(relayer.Queue)
+}
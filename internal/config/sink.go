@@ -0,0 +1,34 @@
+package config
+
+import (
+	"gitlab.com/distributed_lab/figure/v3"
+	"gitlab.com/distributed_lab/kit/kv"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// Sink configures what happens to the collector writes of the service
+type Sink struct {
+	// Record is the JSONL file the writes are appended to, the writes are not
+	// recorded when it is empty
+	Record string `fig:"record"`
+	// DryRun makes the service skip the collector writes, the reads see the
+	// skipped writes as if they were made
+	DryRun bool `fig:"dry_run"`
+	// DryRunOutput is the JSONL file the skipped writes are written to, they
+	// are logged when it is empty
+	DryRunOutput string `fig:"dry_run_output"`
+}
+
+func (c *config) Sink() Sink {
+	return c.sinkOnce.Do(func() interface{} {
+		var cfg Sink
+		err := figure.Out(&cfg).
+			From(kv.MustGetStringMap(c.getter, "sink")).
+			Please()
+		if err != nil {
+			panic(errors.Wrap(err, "failed to figure out sink"))
+		}
+
+		return cfg
+	}).(Sink)
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"github.com/Swapica/indexer-svc/internal/store"
+	"gitlab.com/distributed_lab/figure/v3"
+	"gitlab.com/distributed_lab/kit/kv"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// LocalStore returns nil when the local store is disabled
+func (c *config) LocalStore() *store.Store {
+	return c.storeOnce.Do(func() interface{} {
+		var cfg struct {
+			Enabled bool   `fig:"enabled"`
+			Path    string `fig:"path"`
+		}
+		err := figure.Out(&cfg).
+			From(kv.MustGetStringMap(c.getter, "store")).
+			Please()
+		if err != nil {
+			panic(errors.Wrap(err, "failed to figure out store"))
+		}
+
+		if !cfg.Enabled {
+			return (*store.Store)(nil)
+		}
+
+		s, err := store.New(cfg.Path)
+		if err != nil {
+			panic(errors.Wrap(err, "failed to open local store"))
+		}
+		return s
+	}).(*store.Store)
+}
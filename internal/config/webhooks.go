@@ -0,0 +1,62 @@
+package config
+
+import (
+	"time"
+
+	"github.com/Swapica/indexer-svc/internal/webhook"
+	"gitlab.com/distributed_lab/figure/v3"
+	"gitlab.com/distributed_lab/kit/kv"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// Webhooks configures outgoing notifications. Subscriptions added with the
+// admin API are kept in memory only, so the permanent ones belong here.
+type Webhooks struct {
+	Enabled       bool
+	Subscriptions []webhook.Subscription
+	webhook.Opts
+}
+
+func (c *config) Webhooks() Webhooks {
+	return c.webhooksOnce.Do(func() interface{} {
+		cfg := struct {
+			Enabled        bool                   `fig:"enabled"`
+			Subscriptions  []webhook.Subscription `fig:"subscriptions"`
+			Workers        int                    `fig:"workers"`
+			QueueSize      int                    `fig:"queue_size"`
+			MaxAttempts    int                    `fig:"max_attempts"`
+			RetryPeriod    time.Duration          `fig:"retry_period"`
+			MaxRetryPeriod time.Duration          `fig:"max_retry_period"`
+			Timeout        time.Duration          `fig:"timeout"`
+			KeepDeliveries int                    `fig:"keep_deliveries"`
+		}{
+			Workers:        4,
+			QueueSize:      1024,
+			MaxAttempts:    8,
+			RetryPeriod:    time.Second,
+			MaxRetryPeriod: 5 * time.Minute,
+			Timeout:        10 * time.Second,
+			KeepDeliveries: 1000,
+		}
+		err := figure.Out(&cfg).
+			From(kv.MustGetStringMap(c.getter, "webhooks")).
+			Please()
+		if err != nil {
+			panic(errors.Wrap(err, "failed to figure out webhooks"))
+		}
+
+		return Webhooks{
+			Enabled:       cfg.Enabled,
+			Subscriptions: cfg.Subscriptions,
+			Opts: webhook.Opts{
+				Workers:        cfg.Workers,
+				QueueSize:      cfg.QueueSize,
+				MaxAttempts:    cfg.MaxAttempts,
+				RetryPeriod:    cfg.RetryPeriod,
+				MaxRetryPeriod: cfg.MaxRetryPeriod,
+				Timeout:        cfg.Timeout,
+				KeepDeliveries: cfg.KeepDeliveries,
+			},
+		}
+	}).(Webhooks)
+}
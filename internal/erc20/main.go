@@ -0,0 +1,104 @@
+package erc20
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// Some old tokens (e.g. MKR) return bytes32 instead of string from name() and
+// symbol(), so both ABIs are used
+const (
+	metadataABI = `[
+		{"name":"name","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+		{"name":"symbol","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+		{"name":"decimals","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint8"}]}
+	]`
+	bytes32ABI = `[
+		{"name":"name","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"bytes32"}]},
+		{"name":"symbol","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"bytes32"}]}
+	]`
+)
+
+var (
+	metadata = mustParse(metadataABI)
+	bytes32  = mustParse(bytes32ABI)
+)
+
+func mustParse(raw string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(raw))
+	if err != nil {
+		panic(errors.Wrap(err, "failed to parse ERC20 ABI"))
+	}
+	return parsed
+}
+
+type Metadata struct {
+	Name     string
+	Symbol   string
+	Decimals uint8
+}
+
+// ReadMetadata calls name(), symbol() and decimals() of the token
+func ReadMetadata(ctx context.Context, caller ethereum.ContractCaller, token common.Address) (Metadata, error) {
+	var m Metadata
+	var err error
+
+	if m.Name, err = callString(ctx, caller, token, "name"); err != nil {
+		return m, err
+	}
+	if m.Symbol, err = callString(ctx, caller, token, "symbol"); err != nil {
+		return m, err
+	}
+
+	out, err := call(ctx, caller, token, metadata, "decimals")
+	if err != nil {
+		return m, err
+	}
+	m.Decimals = *abi.ConvertType(out[0], new(uint8)).(*uint8)
+
+	return m, nil
+}
+
+func callString(ctx context.Context, caller ethereum.ContractCaller, token common.Address, method string) (string, error) {
+	out, err := call(ctx, caller, token, metadata, method)
+	if err == nil {
+		return out[0].(string), nil
+	}
+
+	out, bytesErr := call(ctx, caller, token, bytes32, method)
+	if bytesErr != nil {
+		return "", err
+	}
+	raw := out[0].([32]byte)
+	return string(bytes.TrimRight(raw[:], "\x00")), nil
+}
+
+func call(ctx context.Context, caller ethereum.ContractCaller, token common.Address, contract abi.ABI, method string) ([]interface{}, error) {
+	fields := logan.F{"token": token.String(), "method": method}
+
+	input, err := contract.Pack(method)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack call", fields)
+	}
+
+	output, err := caller.CallContract(ctx, ethereum.CallMsg{To: &token, Data: input}, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to call token", fields)
+	}
+
+	out, err := contract.Unpack(method, output)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unpack result", fields)
+	}
+	if len(out) == 0 {
+		return nil, errors.From(errors.New("empty result"), fields)
+	}
+	return out, nil
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import "expvar"
+
+// Counters are published with expvar, so they are available on /debug/vars
+// of any HTTP server using http.DefaultServeMux.
+var (
+	// Transitions counts applied state transitions, keyed by "<entity>:<from>-><to>"
+	Transitions = expvar.NewMap("indexer_state_transitions")
+	// Anomalies counts illegal state transitions, keyed the same way as Transitions
+	Anomalies = expvar.NewMap("indexer_state_anomalies")
+	// MissedLogs counts logs that were not delivered by the subscription, but
+	// were found by the hybrid mode poller
+	MissedLogs = expvar.NewInt("indexer_ws_missed_logs")
+	// Stalls counts detected stalls of the "chain" and of the "subscription"
+	Stalls = expvar.NewMap("indexer_stalls")
+	// WebhookDeliveries counts finished webhook deliveries by "delivered" and "failed"
+	WebhookDeliveries = expvar.NewMap("indexer_webhook_deliveries")
+	// Inconsistencies is the number of cross-chain inconsistencies found by the
+	// last check, keyed by kind
+	Inconsistencies = expvar.NewMap("indexer_crosscheck_inconsistencies")
+	// OriginWaits counts matches "held" until their origin order is indexed and
+	// how they were released: "resolved", "timed_out", or after the timeout with
+	// the origin order "verified" in its chain contract. The matches still held
+	// because the origin order is not in its contract are "unverified".
+	OriginWaits = expvar.NewMap("indexer_origin_waits")
+)
+
+// TransitionKey builds the key used by Transitions and Anomalies
+func TransitionKey(entity, from, to string) string {
+	return entity + ":" + from + "->" + to
+}
+
+// SetInt sets the gauge value of the key, unlike Map.Add which only increments
+func SetInt(m *expvar.Map, key string, value int64) {
+	v := new(expvar.Int)
+	v.Set(value)
+	m.Set(key, v)
+}
@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Swapica/indexer-svc/internal/amount"
+	"github.com/Swapica/indexer-svc/internal/calldata"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+type EventType string
+
+const (
+	OrderCreated EventType = "OrderCreated"
+	OrderUpdated EventType = "OrderUpdated"
+	MatchCreated EventType = "MatchCreated"
+	MatchUpdated EventType = "MatchUpdated"
+)
+
+// Event is a normalized change of an order or a match applied by the indexer.
+// Creator and tokens of the updates are known only with the local store enabled.
+type Event struct {
+	Cursor           string    `json:"cursor"`
+	Type             EventType `json:"type"`
+	ChainID          int64     `json:"chain_id"`
+	OrderID          int64     `json:"order_id,omitempty"`
+	MatchID          int64     `json:"match_id,omitempty"`
+	State            string    `json:"state"`
+	Creator          string    `json:"creator,omitempty"`
+	TokenToSell      string    `json:"token_to_sell,omitempty"`
+	AmountToSell     string    `json:"amount_to_sell,omitempty"`
+	TokenToBuy       string    `json:"token_to_buy,omitempty"`
+	AmountToBuy      string    `json:"amount_to_buy,omitempty"`
+	DestinationChain int64     `json:"destination_chain,omitempty"`
+	OriginChain      int64     `json:"origin_chain,omitempty"`
+	OriginOrderID    int64     `json:"origin_order_id,omitempty"`
+	MatchSwapica     string    `json:"match_swapica,omitempty"`
+	UseRelayer       *bool     `json:"use_relayer,omitempty"`
+	Block            uint64    `json:"block"`
+	TxHash           string    `json:"tx_hash"`
+	LogIndex         uint      `json:"log_index"`
+	// Tx is nil when the transaction could not be fetched
+	Tx *calldata.Tx `json:"tx,omitempty"`
+	amount.Normalized
+}
+
+func (e Event) IsOrder() bool {
+	return e.Type == OrderCreated || e.Type == OrderUpdated
+}
+
+// Filter fields are ignored when empty
+type Filter struct {
+	Creator string
+	// Token matches both token to sell and token to buy
+	Token string
+	// OrderID matches the order events and the match events of the origin order
+	OrderID *int64
+}
+
+// Match reports whether the event passes the filter
+func (f Filter) Match(e Event) bool {
+	if f.Creator != "" && !strings.EqualFold(f.Creator, e.Creator) {
+		return false
+	}
+	if f.Token != "" && !strings.EqualFold(f.Token, e.TokenToSell) && !strings.EqualFold(f.Token, e.TokenToBuy) {
+		return false
+	}
+	if f.OrderID != nil {
+		if e.IsOrder() {
+			return e.OrderID == *f.OrderID
+		}
+		return e.OriginOrderID == *f.OrderID
+	}
+	return true
+}
+
+// Listener is notified after the change was saved to the collector
+type Listener interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// Cursor is the position of the log in the chain, so it stays valid after restart
+func Cursor(block uint64, logIndex uint) string {
+	return fmt.Sprintf("%d-%d", block, logIndex)
+}
+
+func ParseCursor(cursor string) (block uint64, logIndex uint, err error) {
+	if _, err = fmt.Sscanf(cursor, "%d-%d", &block, &logIndex); err != nil {
+		return 0, 0, errors.Wrap(err, "invalid cursor, expected <block>-<log_index>")
+	}
+	return block, logIndex, nil
+}
+
+// IsAfter reports whether the event is later in the chain than the cursor
+func IsAfter(e Event, block uint64, logIndex uint) bool {
+	return e.Block > block || e.Block == block && e.LogIndex > logIndex
+}
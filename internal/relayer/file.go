@@ -0,0 +1,110 @@
+package relayer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// FileQueue keeps every job in a JSON file of the directory, so the indexers
+// of all the chains and the relayer can share it on the same volume. The files
+// are replaced atomically with rename.
+type FileQueue struct {
+	dir string
+}
+
+func NewFileQueue(dir string) (*FileQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed to create queue directory", logan.F{"dir": dir})
+	}
+	return &FileQueue{dir: dir}, nil
+}
+
+func (q *FileQueue) Push(_ context.Context, job Job) error {
+	_, err := os.Stat(q.path(job.ID))
+	if err == nil {
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to check job file", logan.F{"job": job.ID})
+	}
+	return q.write(job)
+}
+
+func (q *FileQueue) Finish(_ context.Context, id string, status Status) error {
+	job, err := q.read(q.path(id))
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	job.Status, job.UpdatedAt = status, time.Now().UTC()
+	return q.write(job)
+}
+
+func (q *FileQueue) List(_ context.Context, status Status) ([]Job, error) {
+	paths, err := filepath.Glob(filepath.Join(q.dir, "*.json"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list job files")
+	}
+
+	result := make([]Job, 0, len(paths))
+	for _, path := range paths {
+		job, err := q.read(path)
+		if err != nil {
+			return nil, err
+		}
+		if status == "" || job.Status == status {
+			result = append(result, job)
+		}
+	}
+	sortJobs(result)
+	return result, nil
+}
+
+func (q *FileQueue) path(id string) string {
+	return filepath.Join(q.dir, id+".json")
+}
+
+func (q *FileQueue) read(path string) (Job, error) {
+	var job Job
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return job, errors.Wrap(err, "failed to read job file", logan.F{"path": path})
+	}
+	err = json.Unmarshal(raw, &job)
+	return job, errors.Wrap(err, "failed to unmarshal job", logan.F{"path": path})
+}
+
+func (q *FileQueue) write(job Job) error {
+	raw, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal job")
+	}
+
+	// the temporary name has no .json suffix, so List never sees it
+	tmp, err := os.CreateTemp(q.dir, job.ID+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary job file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(raw); err != nil {
+		_ = tmp.Close()
+		return errors.Wrap(err, "failed to write job file")
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed to close job file")
+	}
+	err = os.Rename(tmp.Name(), q.path(job.ID))
+	return errors.Wrap(err, "failed to replace job file", logan.F{"job": job.ID})
+}
+
+var _ Queue = (*FileQueue)(nil)
+var _ Queue = (*MemoryQueue)(nil)
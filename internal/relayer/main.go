@@ -0,0 +1,64 @@
+package relayer
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type Kind string
+
+const (
+	// ExecuteOrder pays the match creator on the origin chain of the order
+	ExecuteOrder Kind = "execute_order"
+	// ExecuteMatch pays the order creator on the chain of the match
+	ExecuteMatch Kind = "execute_match"
+)
+
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	// StatusDone means the entity was executed, by the relayer or by anyone else
+	StatusDone Status = "done"
+	// StatusCanceled means the entity was canceled before the execution
+	StatusCanceled Status = "canceled"
+)
+
+// Job is a call the relayer should send to the Swapica contract of ChainID.
+// The signers encode the call data of executeOrder from ChainID, Swapica,
+// OrderID, Receiver, MatchSwapica and MatchID, and the call data of
+// executeMatch from ChainID, Swapica, MatchID and Receiver.
+type Job struct {
+	ID      string `json:"id"`
+	Kind    Kind   `json:"kind"`
+	ChainID int64  `json:"chain_id"`
+	// Swapica is the contract to call
+	Swapica      string `json:"swapica"`
+	OrderID      int64  `json:"order_id"`
+	MatchID      int64  `json:"match_id"`
+	Receiver     string `json:"receiver"`
+	MatchSwapica string `json:"match_swapica,omitempty"`
+	MatchChainID int64  `json:"match_chain_id"`
+	Status       Status `json:"status"`
+	// Cursor is the position of the MatchCreated log the job was created from
+	Cursor    string    `json:"cursor"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// JobID is unique per executed entity, so pushing the same job twice is no-op
+func JobID(kind Kind, chainID, entityID int64) string {
+	return fmt.Sprintf("%s-%d-%d", kind, chainID, entityID)
+}
+
+// Queue passes the jobs to the relayer. Push must ignore the jobs already
+// queued, and Finish must ignore unknown jobs, because every indexer finishes
+// the jobs of its chain, while the jobs are pushed by the indexer of the
+// counterpart chain.
+type Queue interface {
+	Push(ctx context.Context, job Job) error
+	Finish(ctx context.Context, id string, status Status) error
+	// List returns the jobs with the status, all the jobs when it is empty
+	List(ctx context.Context, status Status) ([]Job, error)
+}
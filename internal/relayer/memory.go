@@ -0,0 +1,76 @@
+package relayer
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// finishedRetention is how long the memory queue keeps the finished jobs, so
+// the relayer can see them before they are dropped
+const finishedRetention = time.Hour
+
+// MemoryQueue keeps the jobs in the process, it is useful when the relayer
+// reads them through the admin API of the same indexer. The queue is not
+// shared between processes, so the execute_order jobs are not finished by the
+// indexer of the origin chain, the indexer expires them against the collector
+// instead. The finished jobs are dropped after finishedRetention.
+type MemoryQueue struct {
+	mu   sync.RWMutex
+	jobs map[string]Job
+}
+
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{jobs: make(map[string]Job)}
+}
+
+func (q *MemoryQueue) Push(_ context.Context, job Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.prune()
+	if _, ok := q.jobs[job.ID]; !ok {
+		q.jobs[job.ID] = job
+	}
+	return nil
+}
+
+func (q *MemoryQueue) Finish(_ context.Context, id string, status Status) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.prune()
+	if job, ok := q.jobs[id]; ok {
+		job.Status, job.UpdatedAt = status, time.Now().UTC()
+		q.jobs[id] = job
+	}
+	return nil
+}
+
+func (q *MemoryQueue) List(_ context.Context, status Status) ([]Job, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	result := make([]Job, 0)
+	for _, job := range q.jobs {
+		if status == "" || job.Status == status {
+			result = append(result, job)
+		}
+	}
+	sortJobs(result)
+	return result, nil
+}
+
+// prune drops the jobs finished before finishedRetention
+func (q *MemoryQueue) prune() {
+	before := time.Now().UTC().Add(-finishedRetention)
+	for id, job := range q.jobs {
+		if job.Status != StatusPending && job.UpdatedAt.Before(before) {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func sortJobs(jobs []Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+}
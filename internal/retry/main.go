@@ -0,0 +1,49 @@
+package retry
+
+import (
+	"context"
+	"time"
+)
+
+// Budget limits the attempts of a single call
+type Budget struct {
+	// Timeout is the deadline of every attempt, there is none when zero
+	Timeout time.Duration
+	// Attempts is the total number of attempts, one attempt is made when zero
+	Attempts int
+	// Period is the pause after the first failed attempt, it is doubled after
+	// every next one
+	Period time.Duration
+}
+
+// Do calls fn until it succeeds, fails with an error that is not transient,
+// the attempts are over or ctx is done. The error of the last attempt is
+// returned, or the ctx error when ctx is done during the pause.
+func (b Budget) Do(ctx context.Context, transient func(error) bool, fn func(ctx context.Context) error) error {
+	pause := b.Period
+	for attempt := 1; ; attempt++ {
+		err := b.attempt(ctx, fn)
+		if err == nil || ctx.Err() != nil || attempt >= b.Attempts || !transient(err) {
+			return err
+		}
+
+		timer := time.NewTimer(pause)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		pause *= 2
+	}
+}
+
+func (b Budget) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if b.Timeout == 0 {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, b.Timeout)
+	defer cancel()
+	return fn(ctx)
+}
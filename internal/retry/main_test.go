@@ -0,0 +1,88 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	errTransient = errors.New("transient")
+	errFatal     = errors.New("fatal")
+)
+
+func isTransient(err error) bool {
+	return err == errTransient
+}
+
+func TestBudgetDo(t *testing.T) {
+	cases := []struct {
+		name     string
+		budget   Budget
+		results  []error
+		want     error
+		attempts int
+	}{
+		{name: "success", budget: Budget{Attempts: 3}, results: []error{nil}, want: nil, attempts: 1},
+		{name: "zero attempts make one", budget: Budget{}, results: []error{errTransient}, want: errTransient, attempts: 1},
+		{name: "retried until success", budget: Budget{Attempts: 3}, results: []error{errTransient, errTransient, nil}, want: nil, attempts: 3},
+		{name: "attempts are over", budget: Budget{Attempts: 2}, results: []error{errTransient, errTransient, nil}, want: errTransient, attempts: 2},
+		{name: "not transient", budget: Budget{Attempts: 3}, results: []error{errFatal, nil}, want: errFatal, attempts: 1},
+		{name: "last error returned", budget: Budget{Attempts: 3}, results: []error{errTransient, errFatal}, want: errFatal, attempts: 2},
+	}
+	for _, c := range cases {
+		c.budget.Period = time.Millisecond
+		attempts := 0
+		err := c.budget.Do(context.Background(), isTransient, func(ctx context.Context) error {
+			err := c.results[attempts]
+			attempts++
+			return err
+		})
+		if err != c.want || attempts != c.attempts {
+			t.Errorf("%s: got %v after %d attempts, want %v after %d", c.name, err, attempts, c.want, c.attempts)
+		}
+	}
+}
+
+func TestBudgetDoTimeout(t *testing.T) {
+	b := Budget{Timeout: time.Millisecond, Attempts: 2, Period: time.Millisecond}
+	attempts := 0
+	err := b.Do(context.Background(), func(err error) bool { return err == context.DeadlineExceeded }, func(ctx context.Context) error {
+		attempts++
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("attempt has no deadline")
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err != context.DeadlineExceeded || attempts != 2 {
+		t.Errorf("got %v after %d attempts, want deadline exceeded after 2", err, attempts)
+	}
+}
+
+func TestBudgetDoCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := Budget{Attempts: 3, Period: time.Hour}
+	attempts := 0
+	err := b.Do(ctx, isTransient, func(ctx context.Context) error {
+		attempts++
+		cancel()
+		return errTransient
+	})
+	if err != errTransient || attempts != 1 {
+		t.Errorf("got %v after %d attempts, want the error of the only attempt", err, attempts)
+	}
+
+	// ctx done during the pause
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	attempts = 0
+	err = b.Do(ctx, isTransient, func(ctx context.Context) error {
+		attempts++
+		return errTransient
+	})
+	if err != context.DeadlineExceeded || attempts != 1 {
+		t.Errorf("got %v after %d attempts, want deadline exceeded after 1", err, attempts)
+	}
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Swapica/indexer-svc/internal/notify"
+	"github.com/Swapica/indexer-svc/internal/relayer"
+	"github.com/Swapica/indexer-svc/internal/webhook"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// serveAdmin runs the admin HTTP server until ctx is done, webhook endpoints
+// are served only when hooks is not nil. The resync changes are passed to the
+// listeners of the indexer.
+func (s *service) serveAdmin(ctx context.Context, hooks *webhook.Dispatcher, listeners []notify.Listener) {
+	cfg := s.cfg.Admin()
+	if cfg.Addr == "" {
+		return
+	}
+
+	r := newIndexer(s.cfg, 0)
+	r.collector = s.collector
+	r.listeners = listeners
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/resync/", r.resyncHandler)
+	mux.HandleFunc("/history/", r.historyHandler)
+	if queue := s.cfg.RelayerQueue(); queue != nil {
+		mux.HandleFunc("/relayer/jobs", relayerJobsHandler(queue))
+	}
+	if hooks != nil {
+		h := webhooksHandler{hooks: hooks}
+		mux.HandleFunc("/webhooks", h.subscriptions)
+		mux.HandleFunc("/webhooks/", h.subscription)
+	}
+
+	srv := &http.Server{Addr: cfg.Addr, Handler: requireToken(cfg.Token, mux)}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	s.log.WithField("addr", cfg.Addr).Info("admin server started")
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		s.log.WithError(err).Error("admin server failed")
+	}
+}
+
+// requireToken passes the read-only requests and checks the bearer token of
+// the others, which are refused when no token is configured
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			next.ServeHTTP(w, req)
+			return
+		}
+		if token == "" {
+			writeError(w, http.StatusForbidden, errors.New("admin token is not configured, only GET requests are allowed"))
+			return
+		}
+
+		auth := req.Header.Get("Authorization")
+		got := strings.TrimPrefix(auth, "Bearer ")
+		if got == auth || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("invalid admin token"))
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// resyncHandler serves POST /resync/{order|match}/{id}?from_block=N, the
+// from_block is required, so a request never scans the chain from genesis
+func (r *indexer) resyncHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/resync/"), "/")
+	if len(parts) != 2 {
+		writeError(w, http.StatusNotFound, errors.New("expected /resync/{order|match}/{id}"))
+		return
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "invalid id"))
+		return
+	}
+
+	fromBlock, err := strconv.ParseUint(req.URL.Query().Get("from_block"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "invalid or missing from_block"))
+		return
+	}
+
+	result, err := r.resync(req.Context(), parts[0], id, fromBlock)
+	if err != nil {
+		switch errors.Cause(err) {
+		case ErrUnknownEntity:
+			writeError(w, http.StatusNotFound, err)
+			return
+		case ErrCreationNotFound:
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		r.log.WithError(err).Error("failed to resync")
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// historyHandler serves GET /history/{order|match}/{id}
+func (r *indexer) historyHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/history/"), "/")
+	if len(parts) != 2 {
+		writeError(w, http.StatusNotFound, errors.New("expected /history/{order|match}/{id}"))
+		return
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "invalid id"))
+		return
+	}
+
+	history, err := entityArchive(r.archive, r.chainID, parts[0], id)
+	switch errors.Cause(err) {
+	case nil:
+		writeJSON(w, http.StatusOK, history)
+	case ErrUnknownEntity, ErrArchiveDisabled:
+		writeError(w, http.StatusNotFound, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// relayerJobsHandler serves GET /relayer/jobs?status={pending|done|canceled}
+func relayerJobsHandler(queue relayer.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+
+		jobs, err := queue.List(req.Context(), relayer.Status(req.URL.Query().Get("status")))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, jobs)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/Swapica/indexer-svc/internal/webhook"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+type webhooksHandler struct {
+	hooks *webhook.Dispatcher
+}
+
+// subscriptions serves GET /webhooks listing the subscriptions without
+// secrets and POST /webhooks adding one
+func (h webhooksHandler) subscriptions(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, h.hooks.Subscriptions())
+	case http.MethodPost:
+		var sub webhook.Subscription
+		if err := json.NewDecoder(req.Body).Decode(&sub); err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrap(err, "failed to decode subscription"))
+			return
+		}
+		sub, err := h.hooks.Add(sub)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		sub.Secret = ""
+		writeJSON(w, http.StatusCreated, sub)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// subscription serves GET /webhooks/deliveries?subscription={id} and
+// DELETE /webhooks/{id}
+func (h webhooksHandler) subscription(w http.ResponseWriter, req *http.Request) {
+	id := strings.TrimPrefix(req.URL.Path, "/webhooks/")
+	switch {
+	case req.Method == http.MethodGet && id == "deliveries":
+		writeJSON(w, http.StatusOK, h.hooks.Deliveries(req.URL.Query().Get("subscription")))
+	case req.Method == http.MethodDelete && id != "":
+		if !h.hooks.Remove(id) {
+			writeError(w, http.StatusNotFound, errors.New("subscription not found"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("expected GET /webhooks/deliveries or DELETE /webhooks/{id}"))
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/Swapica/indexer-svc/internal/amount"
+	"github.com/Swapica/indexer-svc/internal/store"
+	"github.com/ethereum/go-ethereum/common"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// normalizeOrder never fails: the amounts of unknown tokens are left empty,
+// so the order is indexed anyway and normalized again by renormalize
+func (r *indexer) normalizeOrder(ctx context.Context, o store.Order) amount.Normalized {
+	var n amount.Normalized
+	log := r.log.WithField("order_id", o.OrderID)
+
+	sellDecimals, sellOk, err := r.tokenDecimals(ctx, r.chainID, common.HexToAddress(o.TokenToSell))
+	if err != nil {
+		log.WithError(err).Warn("failed to get decimals of token to sell")
+	}
+	buyDecimals, buyOk, err := r.tokenDecimals(ctx, o.DestinationChain, common.HexToAddress(o.TokenToBuy))
+	if err != nil {
+		log.WithError(err).Warn("failed to get decimals of token to buy")
+	}
+
+	if sellOk {
+		n.AmountToSell, _ = amount.Normalize(o.AmountToSell, sellDecimals)
+	}
+	if buyOk {
+		n.AmountToBuy, _ = amount.Normalize(o.AmountToBuy, buyDecimals)
+	}
+	if sellOk && buyOk {
+		n.Price, _ = amount.Price(o.AmountToSell, sellDecimals, o.AmountToBuy, buyDecimals)
+	}
+
+	log.WithFields(logan.F{
+		"normalized_amount_to_sell": n.AmountToSell,
+		"normalized_amount_to_buy":  n.AmountToBuy,
+		"price":                     n.Price,
+	}).Debug("order amounts normalized")
+	return n
+}
+
+func (r *indexer) normalizeMatch(ctx context.Context, m store.Match) amount.Normalized {
+	var n amount.Normalized
+
+	decimals, ok, err := r.tokenDecimals(ctx, r.chainID, common.HexToAddress(m.TokenToSell))
+	if err != nil {
+		r.log.WithError(err).WithField("match_id", m.MatchID).
+			Warn("failed to get decimals of token to sell")
+	}
+	if ok {
+		n.AmountToSell, _ = amount.Normalize(m.AmountToSell, decimals)
+	}
+	return n
+}
+
+// renormalize fills the amounts of the stored entities left empty when their
+// tokens were unknown, usually the tokens to buy that were not registered yet
+// by the indexers of their chains. It runs once in unknownTokenTTL, so every
+// unknown token costs a single lookup per run.
+func (r *indexer) renormalize(ctx context.Context) error {
+	if r.store == nil || time.Since(r.renormalizedAt) < unknownTokenTTL {
+		return nil
+	}
+	r.renormalizedAt = time.Now()
+
+	all := store.Page{Limit: math.MaxUint64}
+	for _, o := range r.store.Orders(store.OrdersFilter{Unnormalized: true}, all) {
+		n := r.normalizeOrder(ctx, o)
+		if n == o.Normalized {
+			continue
+		}
+		if err := r.store.UpdateOrderAmounts(o.OrderID, n); err != nil {
+			return errors.Wrap(err, "failed to update order amounts in local store", logan.F{
+				"order_id": o.OrderID,
+			})
+		}
+	}
+
+	for _, m := range r.store.Matches(store.MatchesFilter{Unnormalized: true}, all) {
+		n := r.normalizeMatch(ctx, m)
+		if n == m.Normalized {
+			continue
+		}
+		if err := r.store.UpdateMatchAmounts(m.MatchID, n); err != nil {
+			return errors.Wrap(err, "failed to update match amounts in local store", logan.F{
+				"match_id": m.MatchID,
+			})
+		}
+	}
+	return nil
+}
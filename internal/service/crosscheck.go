@@ -0,0 +1,315 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Swapica/indexer-svc/internal/config"
+	"github.com/Swapica/indexer-svc/internal/metrics"
+	"github.com/Swapica/indexer-svc/internal/service/state"
+	"github.com/Swapica/indexer-svc/internal/sink"
+	"github.com/Swapica/order-aggregator-svc/resources"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+const (
+	// InconsistencyNoMatch is an executed order whose match is not in the collector
+	InconsistencyNoMatch = "order_without_match"
+	// InconsistencyNoOrder is a match whose origin order is not in the collector
+	InconsistencyNoOrder = "match_without_order"
+	// InconsistencyMismatch is a difference of the fields both sides must agree on
+	InconsistencyMismatch = "mismatch"
+)
+
+// Inconsistency is a disagreement between an order and a match of another
+// chain. Some of them are transient while the trade is being finalized, e.g.
+// the match is executed, but the order is not yet.
+type Inconsistency struct {
+	Kind       string      `json:"kind"`
+	OrderChain int64       `json:"order_chain"`
+	OrderID    int64       `json:"order_id"`
+	MatchChain int64       `json:"match_chain"`
+	MatchID    int64       `json:"match_id"`
+	Field      string      `json:"field,omitempty"`
+	Order      interface{} `json:"order,omitempty"`
+	Match      interface{} `json:"match,omitempty"`
+}
+
+// CrossCheck joins the orders and matches of the chains from the collector,
+// all the chains known by the collector are checked when chains are empty.
+// It writes the inconsistencies to out in JSON and reports whether there are none.
+func CrossCheck(cfg config.Config, out io.Writer, chains []int64) (bool, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	found, err := crossCheck(ctx, cfg.Collector(), chains)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to cross-check chains")
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(found); err != nil {
+		return false, errors.Wrap(err, "failed to encode inconsistencies")
+	}
+	return len(found) == 0, nil
+}
+
+// runCrossCheck checks the chains every period, reporting the
+// inconsistencies to the log and to the metrics
+func (s *service) runCrossCheck(ctx context.Context, period time.Duration, chains []int64) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		found, err := crossCheck(ctx, s.cfg.Collector(), chains)
+		if err != nil {
+			s.log.WithError(err).Error("failed to cross-check chains")
+			continue
+		}
+
+		counts := make(map[string]int64)
+		for _, i := range found {
+			counts[i.Kind]++
+			s.log.WithFields(logan.F{
+				"kind":        i.Kind,
+				"order_chain": i.OrderChain,
+				"order_id":    i.OrderID,
+				"match_chain": i.MatchChain,
+				"match_id":    i.MatchID,
+				"field":       i.Field,
+			}).Warn("cross-chain inconsistency found")
+		}
+		for _, kind := range []string{InconsistencyNoMatch, InconsistencyNoOrder, InconsistencyMismatch} {
+			metrics.SetInt(metrics.Inconsistencies, kind, counts[kind])
+		}
+	}
+}
+
+type chainEntities struct {
+	swapContract string
+	orders       map[int64]resources.Order
+	matches      map[int64]resources.Match
+}
+
+func crossCheck(ctx context.Context, collector sink.Collector, chains []int64) ([]Inconsistency, error) {
+	known, err := listChains(ctx, collector)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list chains")
+	}
+	if len(chains) == 0 {
+		for id := range known {
+			chains = append(chains, id)
+		}
+	}
+
+	entities := make(map[int64]*chainEntities, len(chains))
+	for _, chainID := range chains {
+		e := &chainEntities{
+			swapContract: known[chainID],
+			orders:       make(map[int64]resources.Order),
+			matches:      make(map[int64]resources.Match),
+		}
+		fields := logan.F{"chain_id": chainID}
+
+		orders, err := listCollected[resources.Order](ctx, collector, chainID, "/orders")
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list orders", fields)
+		}
+		for _, o := range orders {
+			e.orders[o.Attributes.OrderId] = o
+		}
+		matches, err := listCollected[resources.Match](ctx, collector, chainID, "/match_orders")
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list matches", fields)
+		}
+		for _, m := range matches {
+			e.matches[m.Attributes.MatchId] = m
+		}
+		entities[chainID] = e
+	}
+
+	found := make([]Inconsistency, 0)
+	for orderChain, e := range entities {
+		for _, o := range e.orders {
+			found = append(found, checkOrderSide(orderChain, o, entities)...)
+		}
+	}
+	for matchChain, e := range entities {
+		for _, m := range e.matches {
+			found = append(found, checkMatchSide(matchChain, m, entities)...)
+		}
+	}
+	sortInconsistencies(found)
+	return found, nil
+}
+
+// sortInconsistencies orders the inconsistencies by the trade and the field,
+// so the results of the runs can be compared. The stable sort keeps the
+// order side before the match side for the same field.
+func sortInconsistencies(found []Inconsistency) {
+	sort.SliceStable(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		switch {
+		case a.OrderChain != b.OrderChain:
+			return a.OrderChain < b.OrderChain
+		case a.OrderID != b.OrderID:
+			return a.OrderID < b.OrderID
+		case a.MatchChain != b.MatchChain:
+			return a.MatchChain < b.MatchChain
+		case a.MatchID != b.MatchID:
+			return a.MatchID < b.MatchID
+		default:
+			return a.Field < b.Field
+		}
+	})
+}
+
+// checkOrderSide checks that the match which executed the order agrees with it
+func checkOrderSide(orderChain int64, o resources.Order, entities map[int64]*chainEntities) []Inconsistency {
+	if state.State(o.Attributes.State) != state.Executed || o.Attributes.MatchId == nil {
+		return nil
+	}
+	matchChain, ok := relationChain(o.Relationships.DestinationChain)
+	if !ok {
+		return nil
+	}
+	dest, ok := entities[matchChain]
+	if !ok {
+		// the chain is not checked
+		return nil
+	}
+
+	base := Inconsistency{
+		OrderChain: orderChain,
+		OrderID:    o.Attributes.OrderId,
+		MatchChain: matchChain,
+		MatchID:    *o.Attributes.MatchId,
+	}
+	m, ok := dest.matches[*o.Attributes.MatchId]
+	if !ok {
+		base.Kind = InconsistencyNoMatch
+		return []Inconsistency{base}
+	}
+
+	var found []Inconsistency
+	mismatch := func(field string, order, match interface{}) {
+		i := base
+		i.Kind, i.Field, i.Order, i.Match = InconsistencyMismatch, field, order, match
+		found = append(found, i)
+	}
+
+	if state.State(m.Attributes.State) != state.Executed {
+		mismatch("state", state.Executed.String(), state.State(m.Attributes.State).String())
+	}
+	if m.Attributes.OriginOrderId != o.Attributes.OrderId {
+		mismatch("origin_order_id", o.Attributes.OrderId, m.Attributes.OriginOrderId)
+	}
+	if c, ok := relationChain(m.Relationships.OriginChain); ok && c != orderChain {
+		mismatch("origin_chain", orderChain, c)
+	}
+	if o.Attributes.MatchSwapica != nil && dest.swapContract != "" &&
+		!strings.EqualFold(*o.Attributes.MatchSwapica, dest.swapContract) {
+		mismatch("match_swapica", *o.Attributes.MatchSwapica, dest.swapContract)
+	}
+	return found
+}
+
+// checkMatchSide checks that the match agrees with its origin order
+func checkMatchSide(matchChain int64, m resources.Match, entities map[int64]*chainEntities) []Inconsistency {
+	orderChain, ok := relationChain(m.Relationships.OriginChain)
+	if !ok {
+		return nil
+	}
+	origin, ok := entities[orderChain]
+	if !ok {
+		return nil
+	}
+
+	base := Inconsistency{
+		OrderChain: orderChain,
+		OrderID:    m.Attributes.OriginOrderId,
+		MatchChain: matchChain,
+		MatchID:    m.Attributes.MatchId,
+	}
+	o, ok := origin.orders[m.Attributes.OriginOrderId]
+	if !ok {
+		base.Kind = InconsistencyNoOrder
+		return []Inconsistency{base}
+	}
+
+	var found []Inconsistency
+	mismatch := func(field string, order, match interface{}) {
+		i := base
+		i.Kind, i.Field, i.Order, i.Match = InconsistencyMismatch, field, order, match
+		found = append(found, i)
+	}
+
+	if c, ok := relationChain(o.Relationships.DestinationChain); ok && c != matchChain {
+		mismatch("destination_chain", c, matchChain)
+	}
+	if o.Attributes.AmountToBuy != m.Attributes.AmountToSell {
+		mismatch("amount", o.Attributes.AmountToBuy, m.Attributes.AmountToSell)
+	}
+	if buy, sell := relationID(o.Relationships.TokenToBuy), relationID(m.Relationships.TokenToSell); buy != "" && sell != "" &&
+		!strings.EqualFold(buy, sell) {
+		mismatch("token", buy, sell)
+	}
+	// the order executed by this match is checked from the order side
+	if state.State(m.Attributes.State) == state.Executed &&
+		(state.State(o.Attributes.State) != state.Executed || o.Attributes.MatchId == nil) {
+		mismatch("state", state.State(o.Attributes.State).String(), state.Executed.String())
+	}
+	return found
+}
+
+func relationID(r resources.Relation) string {
+	if r.Data == nil {
+		return ""
+	}
+	return r.Data.ID
+}
+
+func relationChain(r resources.Relation) (int64, bool) {
+	id, err := strconv.ParseInt(relationID(r), 10, 64)
+	return id, err == nil
+}
+
+// listChains returns the swap contracts of the chains known by the collector
+func listChains(ctx context.Context, collector sink.Collector) (map[int64]string, error) {
+	u, _ := url.Parse("/chains")
+
+	var resp resources.ChainListResponse
+	if err := collector.Get(ctx, u, &resp); err != nil {
+		return nil, errors.Wrap(err, "failed to get chains from collector")
+	}
+
+	chains := make(map[int64]string, len(resp.Data))
+	for _, c := range resp.Data {
+		chainID := c.Attributes.ChainParams.ChainId
+		if chainID == 0 {
+			var err error
+			if chainID, err = strconv.ParseInt(c.ID, 10, 64); err != nil {
+				return nil, errors.Wrap(err, "failed to parse chain ID", logan.F{"id": c.ID})
+			}
+		}
+		chains[chainID] = c.Attributes.SwapContract
+	}
+	return chains, nil
+}
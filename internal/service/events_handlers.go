@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/Swapica/indexer-svc/internal/gobind"
+	"github.com/Swapica/indexer-svc/internal/service/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"gitlab.com/distributed_lab/logan/v3"
 	"gitlab.com/distributed_lab/logan/v3/errors"
@@ -21,19 +22,27 @@ func (r *indexer) handleOrderCreated(ctx context.Context, eventName string, log
 		})
 	}
 
-	exists, err := r.orderExists(event.Order.OrderId.Int64())
+	key := entityKey{entity: EntityOrder, id: event.Order.OrderId.Int64()}
+	current, err := r.getOrder(ctx, key.id)
 	if err != nil {
 		return errors.Wrap(err, "failed to check if order exists")
 	}
-	if exists {
-		return nil
+	if current != nil {
+		return r.applyOrphans(ctx, key)
 	}
 
-	if err = r.addOrder(ctx, event.Order, event.UseRelayer); err != nil {
+	created, err := r.addOrder(ctx, event.Order, event.UseRelayer)
+	if err != nil {
 		return errors.Wrap(err, "failed to index order")
 	}
 
-	return nil
+	// the order added before is announced already
+	if created {
+		if err = r.publish(ctx, r.newOrderCreated(ctx, event.Order, event.UseRelayer, log)); err != nil {
+			return err
+		}
+	}
+	return r.applyOrphans(ctx, key)
 }
 
 func (r *indexer) handleOrderUpdated(ctx context.Context, eventName string, log *types.Log) error {
@@ -51,11 +60,19 @@ func (r *indexer) handleOrderUpdated(ctx context.Context, eventName string, log
 		return errors.Wrap(err, "failed to parse order id from topic")
 	}
 
-	if err = r.updateOrder(ctx, big.NewInt(id), event.Status); err != nil {
+	applied, err := r.updateOrder(ctx, big.NewInt(id), event.Status)
+	if errors.Cause(err) == errNotCreated {
+		r.deferUpdate(entityKey{entity: EntityOrder, id: id}, state.State(event.Status.State), *log)
+		return nil
+	}
+	if err != nil {
 		return errors.Wrap(err, "failed to index order")
 	}
+	if !applied {
+		return nil
+	}
 
-	return nil
+	return r.publish(ctx, r.newOrderUpdated(big.NewInt(id), event.Status, log))
 }
 
 func (r *indexer) handleMatchCreated(ctx context.Context, eventName string, log *types.Log) error {
@@ -68,19 +85,48 @@ func (r *indexer) handleMatchCreated(ctx context.Context, eventName string, log
 		})
 	}
 
-	exists, err := r.matchExists(event.Match.MatchId.Int64())
+	key := entityKey{entity: EntityMatch, id: event.Match.MatchId.Int64()}
+	current, err := r.getMatch(ctx, key.id)
 	if err != nil {
 		return errors.Wrap(err, "failed to check if match exists")
 	}
-	if exists {
-		return nil
+	if current != nil {
+		// the listeners could fail after the match was added, then its jobs
+		// are pushed only when the event is handled again
+		if err = r.pushRelayerJobs(ctx, event.Match, event.UseRelayer, log); err != nil {
+			return err
+		}
+		return r.applyOrphans(ctx, key)
 	}
 
-	if err = r.addMatch(ctx, event.Match, event.UseRelayer); err != nil {
-		return errors.Wrap(err, "failed to add match order")
+	if r.originWaitTimeout != 0 {
+		held, err := r.holdMatch(ctx, event.Match, event.UseRelayer, *log)
+		if err != nil {
+			return errors.Wrap(err, "failed to hold match until origin order")
+		}
+		if held {
+			return nil
+		}
+	}
+
+	if err = r.addOrPushMatch(ctx, event.Match, event.UseRelayer, log); err != nil {
+		return err
 	}
+	return r.applyOrphans(ctx, key)
+}
 
-	return nil
+// addOrPushMatch adds the match and announces it when it was created. The
+// match added before is announced already, only its relayer jobs are pushed
+// again.
+func (r *indexer) addOrPushMatch(ctx context.Context, m gobind.ISwapicaMatch, useRelayer bool, log *types.Log) error {
+	created, err := r.addMatch(ctx, m, useRelayer)
+	if err != nil {
+		return errors.Wrap(err, "failed to add match order")
+	}
+	if !created {
+		return r.pushRelayerJobs(ctx, m, useRelayer, log)
+	}
+	return r.publish(ctx, r.newMatchCreated(ctx, m, useRelayer, log))
 }
 
 func (r *indexer) handleMatchUpdated(ctx context.Context, eventName string, log *types.Log) error {
@@ -98,9 +144,17 @@ func (r *indexer) handleMatchUpdated(ctx context.Context, eventName string, log
 		return errors.Wrap(err, "failed to parse match id from topic")
 	}
 
-	if err = r.updateMatch(ctx, big.NewInt(id), event.Status); err != nil {
+	applied, err := r.updateMatch(ctx, big.NewInt(id), event.Status)
+	if errors.Cause(err) == errNotCreated {
+		r.deferUpdate(entityKey{entity: EntityMatch, id: id}, state.State(event.Status), *log)
+		return nil
+	}
+	if err != nil {
 		return errors.Wrap(err, "failed to update match order")
 	}
+	if !applied {
+		return nil
+	}
 
-	return nil
+	return r.publish(ctx, r.newMatchUpdated(big.NewInt(id), event.Status, log))
 }
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/Swapica/indexer-svc/internal/config"
+	"github.com/Swapica/indexer-svc/internal/gobind"
+	"github.com/Swapica/indexer-svc/internal/service/state"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+type ExportOpts struct {
+	ChainID   int64
+	FromBlock uint64
+	// ToBlock is the chain head when nil
+	ToBlock *uint64
+	Format  string
+}
+
+// ExportRecord is an order or a match with the metadata of its creation
+// and last update transactions. Fields not applicable to the entity are empty.
+type ExportRecord struct {
+	Entity           string `json:"entity"`
+	ID               int64  `json:"id"`
+	ChainID          int64  `json:"chain_id"`
+	State            string `json:"state"`
+	Creator          string `json:"creator"`
+	TokenToSell      string `json:"token_to_sell"`
+	AmountToSell     string `json:"amount_to_sell"`
+	TokenToBuy       string `json:"token_to_buy,omitempty"`
+	AmountToBuy      string `json:"amount_to_buy,omitempty"`
+	DestinationChain int64  `json:"destination_chain,omitempty"`
+	OriginChain      int64  `json:"origin_chain,omitempty"`
+	OriginOrderID    int64  `json:"origin_order_id,omitempty"`
+	MatchID          int64  `json:"match_id,omitempty"`
+	MatchSwapica     string `json:"match_swapica,omitempty"`
+	// UseRelayer is unknown when the creation event is out of the range
+	UseRelayer   *bool  `json:"use_relayer"`
+	CreatedBlock uint64 `json:"created_block,omitempty"`
+	CreatedTx    string `json:"created_tx,omitempty"`
+	UpdatedBlock uint64 `json:"updated_block,omitempty"`
+	UpdatedTx    string `json:"updated_tx,omitempty"`
+}
+
+var exportColumns = []string{
+	"entity", "id", "chain_id", "state", "creator", "token_to_sell", "amount_to_sell",
+	"token_to_buy", "amount_to_buy", "destination_chain", "origin_chain", "origin_order_id",
+	"match_id", "match_swapica", "use_relayer", "created_block", "created_tx", "updated_block", "updated_tx",
+}
+
+func (e ExportRecord) csvRow() []string {
+	optInt := func(v int64) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.FormatInt(v, 10)
+	}
+	optUint := func(v uint64) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.FormatUint(v, 10)
+	}
+	useRelayer := ""
+	if e.UseRelayer != nil {
+		useRelayer = strconv.FormatBool(*e.UseRelayer)
+	}
+
+	return []string{
+		e.Entity, strconv.FormatInt(e.ID, 10), strconv.FormatInt(e.ChainID, 10), e.State, e.Creator,
+		e.TokenToSell, e.AmountToSell, e.TokenToBuy, e.AmountToBuy, optInt(e.DestinationChain),
+		optInt(e.OriginChain), optInt(e.OriginOrderID), optInt(e.MatchID), e.MatchSwapica, useRelayer,
+		optUint(e.CreatedBlock), e.CreatedTx, optUint(e.UpdatedBlock), e.UpdatedTx,
+	}
+}
+
+// Export writes every order and match created or updated in the block range
+// to out reading the events and the contract, the collector is not used
+func Export(cfg config.Config, out io.Writer, opts ExportOpts) error {
+	if opts.ChainID != 0 && opts.ChainID != cfg.Network().ChainID {
+		return errors.From(errors.New("chain is not the configured one"), logan.F{
+			"chain":            opts.ChainID,
+			"network.chain_id": cfg.Network().ChainID,
+		})
+	}
+	if opts.Format != FormatCSV && opts.Format != FormatJSONL {
+		return errors.From(errors.New("unsupported format"), logan.F{"format": opts.Format})
+	}
+
+	r := newIndexer(cfg, 0)
+	records, err := r.exportRecords(context.Background(), opts)
+	if err != nil {
+		return errors.Wrap(err, "failed to collect records")
+	}
+
+	if opts.Format == FormatJSONL {
+		enc := json.NewEncoder(out)
+		for _, rec := range records {
+			if err = enc.Encode(rec); err != nil {
+				return errors.Wrap(err, "failed to write record")
+			}
+		}
+		return nil
+	}
+
+	w := csv.NewWriter(out)
+	if err = w.Write(exportColumns); err != nil {
+		return errors.Wrap(err, "failed to write header")
+	}
+	for _, rec := range records {
+		if err = w.Write(rec.csvRow()); err != nil {
+			return errors.Wrap(err, "failed to write record")
+		}
+	}
+	w.Flush()
+	return errors.Wrap(w.Error(), "failed to flush records")
+}
+
+func (r *indexer) exportRecords(ctx context.Context, opts ExportOpts) ([]*ExportRecord, error) {
+	to := opts.ToBlock
+	if to == nil {
+		head, err := r.blockNumber(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get last block number")
+		}
+		to = &head
+	}
+
+	// records are kept in the order they were seen first
+	var records []*ExportRecord
+	orders := make(map[int64]*ExportRecord)
+	matches := make(map[int64]*ExportRecord)
+	record := func(entity string, id int64) *ExportRecord {
+		known := orders
+		if entity == EntityMatch {
+			known = matches
+		}
+		if rec, ok := known[id]; ok {
+			return rec
+		}
+		rec := &ExportRecord{Entity: entity, ID: id, ChainID: r.chainID}
+		known[id] = rec
+		records = append(records, rec)
+		return rec
+	}
+
+	err := r.forEachLog(ctx, r.filters(), opts.FromBlock, *to, func(log types.Log) error {
+		event, err := r.swapicaAbi.EventByID(log.Topics[0])
+		if err != nil {
+			return errors.Wrap(err, "failed to get event by topic")
+		}
+
+		switch event.Name {
+		case "OrderCreated":
+			var e gobind.SwapicaOrderCreated
+			if err = r.swapicaAbi.UnpackIntoInterface(&e, event.Name, log.Data); err != nil {
+				return errors.Wrap(err, "failed to unpack event", logan.F{"event": event.Name})
+			}
+			rec := record(EntityOrder, e.Order.OrderId.Int64())
+			rec.setOrder(e.Order)
+			rec.UseRelayer = &e.UseRelayer
+			rec.CreatedBlock, rec.CreatedTx = log.BlockNumber, log.TxHash.Hex()
+		case "OrderUpdated":
+			var e gobind.SwapicaOrderUpdated
+			if err = r.swapicaAbi.UnpackIntoInterface(&e, event.Name, log.Data); err != nil {
+				return errors.Wrap(err, "failed to unpack event", logan.F{"event": event.Name})
+			}
+			rec := record(EntityOrder, log.Topics[1].Big().Int64())
+			rec.setOrderStatus(e.Status)
+			rec.UpdatedBlock, rec.UpdatedTx = log.BlockNumber, log.TxHash.Hex()
+		case "MatchCreated":
+			var e gobind.SwapicaMatchCreated
+			if err = r.swapicaAbi.UnpackIntoInterface(&e, event.Name, log.Data); err != nil {
+				return errors.Wrap(err, "failed to unpack event", logan.F{"event": event.Name})
+			}
+			rec := record(EntityMatch, e.Match.MatchId.Int64())
+			rec.setMatch(e.Match)
+			rec.UseRelayer = &e.UseRelayer
+			rec.CreatedBlock, rec.CreatedTx = log.BlockNumber, log.TxHash.Hex()
+		case "MatchUpdated":
+			var e gobind.SwapicaMatchUpdated
+			if err = r.swapicaAbi.UnpackIntoInterface(&e, event.Name, log.Data); err != nil {
+				return errors.Wrap(err, "failed to unpack event", logan.F{"event": event.Name})
+			}
+			rec := record(EntityMatch, log.Topics[1].Big().Int64())
+			rec.State = state.State(e.Status).String()
+			rec.UpdatedBlock, rec.UpdatedTx = log.BlockNumber, log.TxHash.Hex()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// entities created before the range have only the state from the update
+	for _, rec := range records {
+		if rec.CreatedTx != "" {
+			continue
+		}
+		if err = r.fillFromContract(ctx, rec); err != nil {
+			return nil, errors.Wrap(err, "failed to fill record from contract", logan.F{
+				"entity": rec.Entity,
+				"id":     rec.ID,
+			})
+		}
+	}
+
+	return records, nil
+}
+
+func (r *indexer) fillFromContract(ctx context.Context, rec *ExportRecord) error {
+	// the status is taken from the last update in the range, not from the
+	// contract, so the state and the match fields agree
+	s, matchID, matchSwapica := rec.State, rec.MatchID, rec.MatchSwapica
+	if rec.Entity == EntityOrder {
+		o, err := r.getContractOrder(ctx, rec.ID)
+		if err != nil {
+			return err
+		}
+		rec.setOrder(*o)
+	} else {
+		m, err := r.getContractMatch(ctx, rec.ID)
+		if err != nil {
+			return err
+		}
+		rec.setMatch(*m)
+	}
+	rec.State, rec.MatchID, rec.MatchSwapica = s, matchID, matchSwapica
+	return nil
+}
+
+func (e *ExportRecord) setOrder(o gobind.ISwapicaOrder) {
+	e.Creator = o.Creator.Hex()
+	e.TokenToSell = o.TokenToSell.Hex()
+	e.AmountToSell = o.AmountToSell.String()
+	e.TokenToBuy = o.TokenToBuy.Hex()
+	e.AmountToBuy = o.AmountToBuy.String()
+	e.DestinationChain = o.DestinationChain.Int64()
+	e.setOrderStatus(o.Status)
+}
+
+func (e *ExportRecord) setOrderStatus(s gobind.ISwapicaOrderStatus) {
+	e.State = state.State(s.State).String()
+	if s.MatchId != nil {
+		e.MatchID = s.MatchId.Int64()
+	}
+	if s.MatchSwapica != (common.Address{}) {
+		e.MatchSwapica = s.MatchSwapica.Hex()
+	}
+}
+
+func (e *ExportRecord) setMatch(m gobind.ISwapicaMatch) {
+	e.State = state.State(m.State).String()
+	e.Creator = m.Creator.Hex()
+	e.TokenToSell = m.TokenToSell.Hex()
+	e.AmountToSell = m.AmountToSell.String()
+	e.OriginChain = m.OriginChainId.Int64()
+	e.OriginOrderID = m.OriginOrderId.Int64()
+}
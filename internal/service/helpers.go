@@ -3,10 +3,16 @@ package service
 import (
 	"context"
 	"github.com/Swapica/indexer-svc/internal/gobind"
+	"github.com/Swapica/indexer-svc/internal/metrics"
 	"github.com/Swapica/indexer-svc/internal/service/requests"
+	"github.com/Swapica/indexer-svc/internal/service/state"
+	"github.com/Swapica/indexer-svc/internal/sink"
+	"github.com/Swapica/order-aggregator-svc/resources"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"gitlab.com/distributed_lab/json-api-connector/cerrors"
+	"gitlab.com/distributed_lab/logan/v3"
 	"gitlab.com/distributed_lab/logan/v3/errors"
 	"math/big"
 	"net/http"
@@ -14,7 +20,7 @@ import (
 	"strconv"
 )
 
-var NotFound = errors.New("not found")
+const collectorPageLimit = 100
 
 func (r *indexer) filters() ethereum.FilterQuery {
 	topics := make([]common.Hash, 0, len(r.handlers))
@@ -35,94 +41,250 @@ func (r *indexer) filters() ethereum.FilterQuery {
 	return filterQuery
 }
 
-func (r *indexer) addOrder(ctx context.Context, o gobind.ISwapicaOrder, useRelayer bool) error {
-	log := r.log.WithField("order_id", o.OrderId.String())
+// forEachLog calls fn for every log matching the query in the blocks from-to
+// inclusive, splitting the range by block_range
+func (r *indexer) forEachLog(
+	ctx context.Context, query ethereum.FilterQuery, from, to uint64, fn func(types.Log) error,
+) error {
+	for start := from; start <= to; {
+		end := to
+		if r.blockRange != 0 && start+r.blockRange < end {
+			end = start + r.blockRange
+		}
+
+		query.FromBlock = new(big.Int).SetUint64(start)
+		query.ToBlock = new(big.Int).SetUint64(end)
+
+		logs, err := r.filterLogs(ctx, query)
+		if err != nil {
+			return errors.Wrap(err, "failed to get filter logs", logan.F{
+				"from": start,
+				"to":   end,
+			})
+		}
+
+		for _, log := range logs {
+			if err = fn(log); err != nil {
+				return err
+			}
+		}
+		start = end + 1
+	}
+
+	return nil
+}
+
+// addOrder reports whether the order was created, it is not when the
+// collector already has it
+func (r *indexer) addOrder(ctx context.Context, o gobind.ISwapicaOrder, useRelayer bool) (bool, error) {
+	log := r.log.WithFields(logan.F{
+		"order_id": o.OrderId.String(),
+		"state":    state.State(o.Status.State).String(),
+	})
 	log.Debug("adding new order")
+	r.checkOrderTransition(log, state.None, state.State(o.Status.State))
+	if err := r.ensureToken(ctx, o.TokenToSell); err != nil {
+		return false, errors.Wrap(err, "failed to register token to sell")
+	}
 	body := requests.NewAddOrder(o, r.chainID, useRelayer)
 	u, _ := url.Parse("/orders")
 
-	err := r.collector.PostJSON(u, body, ctx, nil)
+	created := true
+	err := r.collector.PostJSON(ctx, u, body, nil)
 	if isConflict(err) {
 		log.Warn("order already exists in collector DB, skipping it")
-		return nil
+		created, err = false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed to add order into collector service")
 	}
 
-	return errors.Wrap(err, "failed to add order into collector service")
+	return created, r.storeOrder(ctx, o, useRelayer)
 }
 
-func (r *indexer) updateOrder(ctx context.Context, id *big.Int, status gobind.ISwapicaOrderStatus) error {
-	r.log.WithField("order_id", id.String()).Debug("updating order status")
-	body := requests.NewUpdateOrder(id, status)
-	u, _ := url.Parse(strconv.FormatInt(r.chainID, 10) + "/orders")
-	err := r.collector.PatchJSON(u, body, ctx, nil)
-	return errors.Wrap(err, "failed to update order in collector service")
-}
+// updateOrder reports whether the update was applied, it is not applied when
+// the state transition is illegal. errNotCreated is returned when the order is
+// not in the collector.
+func (r *indexer) updateOrder(ctx context.Context, id *big.Int, status gobind.ISwapicaOrderStatus) (bool, error) {
+	log := r.log.WithFields(logan.F{
+		"order_id": id.String(),
+		"state":    state.State(status.State).String(),
+	})
+	log.Debug("updating order status")
 
-func (r *indexer) orderExists(id int64) (bool, error) {
-	u, err := url.Parse("/orders/" + strconv.FormatInt(id, 10))
+	current, err := r.getOrder(ctx, id.Int64())
 	if err != nil {
-		return false, errors.Wrap(err, "failed to parse url")
+		return false, errors.Wrap(err, "failed to get current order state")
+	}
+	if current == nil {
+		return false, errNotCreated
+	}
+	if !r.checkOrderTransition(log, state.State(current.Attributes.State), state.State(status.State)) {
+		return false, nil
 	}
 
-	var order Order
+	return true, r.patchOrder(ctx, id, status)
+}
 
-	err = r.collector.Get(u, &order)
-	if err != nil && err.Error() != NotFound.Error() {
-		return false, errors.Wrap(err, "failed to get order")
+// patchOrder writes the order status without checking the state transition
+func (r *indexer) patchOrder(ctx context.Context, id *big.Int, status gobind.ISwapicaOrderStatus) error {
+	body := requests.NewUpdateOrder(id, status)
+	u, _ := url.Parse(strconv.FormatInt(r.chainID, 10) + "/orders")
+	if err := r.collector.PatchJSON(ctx, u, body, nil); err != nil {
+		return errors.Wrap(err, "failed to update order in collector service")
 	}
 
-	return id == order.OrderID, nil
+	return r.storeOrderStatus(id, status)
 }
 
-func (r *indexer) addMatch(ctx context.Context, mo gobind.ISwapicaMatch, useRelayer bool) error {
-	log := r.log.WithField("match_id", mo.MatchId.String())
+// addMatch is the same as addOrder, but for matches
+func (r *indexer) addMatch(ctx context.Context, mo gobind.ISwapicaMatch, useRelayer bool) (bool, error) {
+	log := r.log.WithFields(logan.F{
+		"match_id": mo.MatchId.String(),
+		"state":    state.State(mo.State).String(),
+	})
 	log.Debug("adding new match order")
+	r.checkMatchTransition(log, state.None, state.State(mo.State))
+	if err := r.ensureToken(ctx, mo.TokenToSell); err != nil {
+		return false, errors.Wrap(err, "failed to register token to sell")
+	}
 	body := requests.NewAddMatch(mo, r.chainID, useRelayer)
 	u, _ := url.Parse("/match_orders")
 
-	err := r.collector.PostJSON(u, body, ctx, nil)
+	created := true
+	err := r.collector.PostJSON(ctx, u, body, nil)
 	if isConflict(err) {
 		log.Warn("match order already exists in collector DB, skipping it")
-		return nil
+		created, err = false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed to add match order into collector service")
 	}
 
-	return errors.Wrap(err, "failed to add match order into collector service")
+	return created, r.storeMatch(ctx, mo, useRelayer)
 }
 
-func (r *indexer) updateMatch(ctx context.Context, id *big.Int, state uint8) error {
-	r.log.WithField("match_id", id.String()).Debug("updating match state")
-	body := requests.NewUpdateMatch(id, state)
+// updateMatch is the same as updateOrder, but for matches
+func (r *indexer) updateMatch(ctx context.Context, id *big.Int, newState uint8) (bool, error) {
+	log := r.log.WithFields(logan.F{
+		"match_id": id.String(),
+		"state":    state.State(newState).String(),
+	})
+	log.Debug("updating match state")
+
+	current, err := r.getMatch(ctx, id.Int64())
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get current match state")
+	}
+	if current == nil {
+		return false, errNotCreated
+	}
+	if !r.checkMatchTransition(log, state.State(current.Attributes.State), state.State(newState)) {
+		return false, nil
+	}
+
+	return true, r.patchMatch(ctx, id, newState)
+}
+
+// patchMatch writes the match state without checking the state transition
+func (r *indexer) patchMatch(ctx context.Context, id *big.Int, newState uint8) error {
+	body := requests.NewUpdateMatch(id, newState)
 	u, _ := url.Parse(strconv.FormatInt(r.chainID, 10) + "/match_orders")
-	err := r.collector.PatchJSON(u, body, ctx, nil)
-	return errors.Wrap(err, "failed to update match order in collector service")
+	if err := r.collector.PatchJSON(ctx, u, body, nil); err != nil {
+		return errors.Wrap(err, "failed to update match order in collector service")
+	}
+
+	return r.storeMatchState(id, newState)
 }
 
-func (r *indexer) matchExists(id int64) (bool, error) {
-	u, err := url.Parse("/match_orders/" + strconv.FormatInt(id, 10))
-	if err != nil {
-		return false, errors.Wrap(err, "failed to parse url")
+// getOrder returns nil order without error when it is not found in collector.
+// The IDs are per contract, so the order is looked up within this chain.
+func (r *indexer) getOrder(ctx context.Context, id int64) (*resources.Order, error) {
+	return r.getChainOrder(ctx, r.chainID, id)
+}
+
+// getMatch is the same as getOrder, but for matches
+func (r *indexer) getMatch(ctx context.Context, id int64) (*resources.Match, error) {
+	u, _ := url.Parse("/match_orders")
+	q := u.Query()
+	q.Set("filter[src_chain]", strconv.FormatInt(r.chainID, 10))
+	q.Set("filter[match_id]", strconv.FormatInt(id, 10))
+	u.RawQuery = q.Encode()
+
+	var resp resources.MatchListResponse
+	if err := r.collector.Get(ctx, u, &resp); err != nil {
+		return nil, errors.Wrap(err, "failed to get match")
+	}
+	for _, m := range resp.Data {
+		if m.Attributes.MatchId == id {
+			return &m, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkOrderTransition records the transition in metrics and reports whether
+// it is legal, illegal transitions are logged as anomalies
+func (r *indexer) checkOrderTransition(log *logan.Entry, from, to state.State) bool {
+	key := metrics.TransitionKey("order", from.String(), to.String())
+	if !state.CanOrderMove(from, to) {
+		metrics.Anomalies.Add(key, 1)
+		log.WithField("current_state", from.String()).Warn("illegal order state transition detected")
+		return false
 	}
 
-	var match Match
+	metrics.Transitions.Add(key, 1)
+	return true
+}
 
-	err = r.collector.Get(u, &match)
-	if err != nil && err.Error() != NotFound.Error() {
-		return false, errors.Wrap(err, "failed to get match")
+// checkMatchTransition is the same as checkOrderTransition, but for matches
+func (r *indexer) checkMatchTransition(log *logan.Entry, from, to state.State) bool {
+	key := metrics.TransitionKey("match", from.String(), to.String())
+	if !state.CanMatchMove(from, to) {
+		metrics.Anomalies.Add(key, 1)
+		log.WithField("current_state", from.String()).Warn("illegal match state transition detected")
+		return false
 	}
 
-	return id == match.MatchID, nil
+	metrics.Transitions.Add(key, 1)
+	return true
 }
 
 func (r *indexer) updateLastBlock(ctx context.Context, lastBlock uint64) error {
 	body := requests.NewUpdateBlock(lastBlock)
 	u, _ := url.Parse(strconv.FormatInt(r.chainID, 10) + "/block")
-	err := r.collector.PostJSON(u, body, ctx, nil)
+	err := r.collector.PostJSON(ctx, u, body, nil)
 	if err != nil {
 		return errors.Wrap(err, "failed to save last block")
 	}
 	return nil
 }
 
+// listCollected pages through the collector list of the chain entities
+func listCollected[T any](ctx context.Context, collector sink.Collector, chainID int64, path string) ([]T, error) {
+	var result []T
+	for page := 0; ; page++ {
+		u, _ := url.Parse(path)
+		q := u.Query()
+		q.Set("filter[src_chain]", strconv.FormatInt(chainID, 10))
+		q.Set("page[limit]", strconv.Itoa(collectorPageLimit))
+		q.Set("page[number]", strconv.Itoa(page))
+		u.RawQuery = q.Encode()
+
+		var resp struct {
+			Data []T `json:"data"`
+		}
+		if err := collector.Get(ctx, u, &resp); err != nil {
+			return nil, errors.Wrap(err, "failed to get page", logan.F{"page": page})
+		}
+
+		result = append(result, resp.Data...)
+		if len(resp.Data) < collectorPageLimit {
+			return result, nil
+		}
+	}
+}
+
 func isConflict(err error) bool {
 	c, ok := err.(cerrors.Error)
 	return ok && c.Status() == http.StatusConflict
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/Swapica/indexer-svc/internal/archive"
+	"github.com/Swapica/indexer-svc/internal/config"
+	"github.com/Swapica/indexer-svc/internal/gobind"
+	"github.com/Swapica/indexer-svc/internal/service/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+var ErrArchiveDisabled = errors.New("event archive is disabled")
+
+// PrintHistory writes the archived events of the order or match to out in JSON
+func PrintHistory(cfg config.Config, out io.Writer, entity string, id int64) error {
+	history, err := entityArchive(cfg.EventArchive(), cfg.Network().ChainID, entity, id)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(history), "failed to encode history")
+}
+
+func entityArchive(a *archive.Archive, chainID int64, entity string, id int64) ([]archive.Record, error) {
+	if a == nil {
+		return nil, ErrArchiveDisabled
+	}
+	if entity != EntityOrder && entity != EntityMatch {
+		return nil, errors.From(ErrUnknownEntity, logan.F{"entity": entity})
+	}
+	return a.History(chainID, entity, id), nil
+}
+
+// archiveLog is no-op without the archive or when the log is archived already
+func (r *indexer) archiveLog(ctx context.Context, eventName string, log types.Log) error {
+	if r.archive == nil || r.archive.Has(r.chainID, log) {
+		return nil
+	}
+
+	rec, err := r.newRecord(eventName, log)
+	if err != nil {
+		return errors.Wrap(err, "failed to describe event")
+	}
+	rec.Tx = r.txDetails(ctx, log.TxHash)
+
+	return errors.Wrap(r.archive.Append(rec), "failed to archive event")
+}
+
+// unarchiveLog drops the log removed by a chain reorganization from the
+// archive, so it is not replayed
+func (r *indexer) unarchiveLog(log types.Log) error {
+	if r.archive == nil {
+		return nil
+	}
+	return errors.Wrap(r.archive.Remove(r.chainID, log), "failed to remove event from archive")
+}
+
+func (r *indexer) newRecord(eventName string, log types.Log) (archive.Record, error) {
+	rec := archive.Record{
+		ChainID:    r.chainID,
+		Event:      eventName,
+		Block:      log.BlockNumber,
+		TxHash:     log.TxHash.Hex(),
+		LogIndex:   log.Index,
+		RecordedAt: time.Now().UTC(),
+		Log:        log,
+	}
+
+	var s uint8
+	switch eventName {
+	case "OrderCreated":
+		var e gobind.SwapicaOrderCreated
+		if err := r.swapicaAbi.UnpackIntoInterface(&e, eventName, log.Data); err != nil {
+			return rec, errors.Wrap(err, "failed to unpack event", logan.F{"event": eventName})
+		}
+		rec.Entity, rec.ID, s = archive.EntityOrder, e.Order.OrderId.Int64(), e.Order.Status.State
+	case "OrderUpdated":
+		var e gobind.SwapicaOrderUpdated
+		if err := r.swapicaAbi.UnpackIntoInterface(&e, eventName, log.Data); err != nil {
+			return rec, errors.Wrap(err, "failed to unpack event", logan.F{"event": eventName})
+		}
+		rec.Entity, rec.ID, s = archive.EntityOrder, new(big.Int).SetBytes(log.Topics[1].Bytes()).Int64(), e.Status.State
+	case "MatchCreated":
+		var e gobind.SwapicaMatchCreated
+		if err := r.swapicaAbi.UnpackIntoInterface(&e, eventName, log.Data); err != nil {
+			return rec, errors.Wrap(err, "failed to unpack event", logan.F{"event": eventName})
+		}
+		rec.Entity, rec.ID, s = archive.EntityMatch, e.Match.MatchId.Int64(), e.Match.State
+	case "MatchUpdated":
+		var e gobind.SwapicaMatchUpdated
+		if err := r.swapicaAbi.UnpackIntoInterface(&e, eventName, log.Data); err != nil {
+			return rec, errors.Wrap(err, "failed to unpack event", logan.F{"event": eventName})
+		}
+		rec.Entity, rec.ID, s = archive.EntityMatch, new(big.Int).SetBytes(log.Topics[1].Bytes()).Int64(), e.Status
+	default:
+		return rec, errors.From(errors.New("event can't be archived"), logan.F{"event": eventName})
+	}
+
+	rec.State = state.State(s).String()
+	return rec, nil
+}
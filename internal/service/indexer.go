@@ -6,14 +6,18 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Swapica/indexer-svc/internal/archive"
 	"github.com/Swapica/indexer-svc/internal/config"
 	"github.com/Swapica/indexer-svc/internal/gobind"
+	"github.com/Swapica/indexer-svc/internal/notify"
+	"github.com/Swapica/indexer-svc/internal/retry"
+	"github.com/Swapica/indexer-svc/internal/sink"
+	"github.com/Swapica/indexer-svc/internal/store"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
-	jsonapi "gitlab.com/distributed_lab/json-api-connector"
 	"gitlab.com/distributed_lab/logan/v3"
 	"gitlab.com/distributed_lab/logan/v3/errors"
 )
@@ -21,7 +25,7 @@ import (
 type indexer struct {
 	log       *logan.Entry
 	swapica   *gobind.Swapica
-	collector *jsonapi.Connector
+	collector sink.Collector
 	ethClient *ethclient.Client
 	wsClient  *ethclient.Client
 
@@ -29,22 +33,43 @@ type indexer struct {
 	blockRange        uint64
 	lastBlock         uint64
 	lastBlockOutdated bool
-	requestTimeout    time.Duration
+	lastApplied       *logPosition
+	orphans           *orphanUpdates
+	held              map[int64]*heldMatch
+	hybrid            *hybridPoller
+	watchdog          *watchdog
+	store             *store.Store
+	renormalizedAt    time.Time
+	listeners         []notify.Listener
+	jobs              *relayerJobs
+	tokens            *tokenCache
+	origins           *originContracts
+	originWaitTimeout time.Duration
+	originFallback    bool
+	relayers          map[common.Address]struct{}
+	lastTx            txMemo
+	archive           *archive.Archive
+	rpcBudget         retry.Budget
 	handlers          map[string]Handler
 	swapicaAbi        abi.ABI
 	contractAddress   common.Address
 	indexPeriod       time.Duration
+
+	// writes is the context of the event handling, it outlives the context of
+	// the indexing loops by the shutdown grace period, the loops context is
+	// used when it is nil
+	writes context.Context
 }
 
 type Handler func(ctx context.Context, eventName string, log *types.Log) error
 
-func newIndexer(c config.Config, lastBlock uint64) indexer {
+func newIndexer(c config.Config, lastBlock uint64) *indexer {
 	swapicaAbi, err := abi.JSON(strings.NewReader(gobind.SwapicaMetaData.ABI))
 	if err != nil {
 		panic(errors.Wrap(err, "failed to get ABI"))
 	}
 
-	indexerInstance := indexer{
+	indexerInstance := &indexer{
 		log:             c.Log(),
 		swapica:         c.Network().Swapica,
 		collector:       c.Collector(),
@@ -53,10 +78,27 @@ func newIndexer(c config.Config, lastBlock uint64) indexer {
 		chainID:         c.Network().ChainID,
 		blockRange:      c.Network().BlockRange,
 		lastBlock:       lastBlock,
-		requestTimeout:  c.Network().RequestTimeout,
+		rpcBudget:       c.Network().Retry,
 		swapicaAbi:      swapicaAbi,
 		contractAddress: c.Network().ContractAddress,
 		indexPeriod:     c.Network().IndexPeriod,
+		watchdog:        newWatchdog(c.Network().StallTimeout, c.Network().MaxLagBlocks),
+		store:           c.LocalStore(),
+		tokens:          newTokenCache(),
+		archive:         c.EventArchive(),
+		origins:         newOriginContracts(),
+		orphans:         newOrphanUpdates(),
+		held:            make(map[int64]*heldMatch),
+
+		originWaitTimeout: c.Network().OriginWaitTimeout,
+		originFallback:    c.Network().OriginFallback,
+	}
+	indexerInstance.relayers = make(map[common.Address]struct{}, len(c.Network().Relayers))
+	for _, addr := range c.Network().Relayers {
+		indexerInstance.relayers[addr] = struct{}{}
+	}
+	if c.Network().HybridMode {
+		indexerInstance.hybrid = newHybridPoller()
 	}
 
 	indexerInstance.handlers = map[string]Handler{
@@ -69,24 +111,64 @@ func newIndexer(c config.Config, lastBlock uint64) indexer {
 	return indexerInstance
 }
 
+// errSubscriptionFailed marks errors after which the subscription can be
+// recreated without returning from run
+var errSubscriptionFailed = errors.New("log subscription failed")
+
 func (r *indexer) run(ctx context.Context) error {
-	lastChainBlock, err := r.ethClient.BlockNumber(ctx)
+	for {
+		err := r.subscribeAndIndex(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Cause(err) != errSubscriptionFailed {
+			return err
+		}
+
+		r.log.WithError(err).WithField("last_block", r.lastBlock).
+			Warn("log subscription dropped, resubscribing")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.indexPeriod):
+		}
+	}
+}
+
+// subscribeAndIndex subscribes to new logs before fetching the chain head, so
+// no log can fall between the backfill and the subscription. Logs delivered by
+// both of them are deduplicated in handleEvent.
+func (r *indexer) subscribeAndIndex(ctx context.Context) error {
+	var sub subscription
+	var err error
+
+	sub.events = make(chan types.Log, 1024)
+	sub.logs, err = r.wsClient.SubscribeFilterLogs(ctx, r.filters(), sub.events)
 	if err != nil {
-		return errors.Wrap(err, "failed to get last block number")
+		return errors.From(errSubscriptionFailed, logan.F{"reason": err.Error()})
 	}
+	defer sub.logs.Unsubscribe()
 
-	newEvents := make(chan types.Log, 1024)
-	sub, err := r.wsClient.SubscribeFilterLogs(ctx, r.filters(), newEvents)
+	sub.headers = make(chan *types.Header, 16)
+	sub.heads, err = r.wsClient.SubscribeNewHead(ctx, sub.headers)
 	if err != nil {
-		return errors.Wrap(err, "failed to subscribe to logs")
+		return errors.From(errSubscriptionFailed, logan.F{"reason": err.Error()})
+	}
+	defer sub.heads.Unsubscribe()
+
+	lastChainBlock, err := r.blockNumber(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get last block number")
 	}
-	defer sub.Unsubscribe()
 
 	if err := r.handleUnprocessedEvents(ctx, lastChainBlock); err != nil {
 		return errors.Wrap(err, "failed to handle unprocessed events")
 	}
+	r.resetPoller(lastChainBlock)
+	r.watchdog.wsHead = lastChainBlock
 
-	if err := r.waitForEvents(ctx, sub, newEvents); err != nil {
+	if err := r.waitForEvents(ctx, sub); err != nil {
 		return errors.Wrap(err, "failed to wait for unprocessed events")
 	}
 
@@ -94,7 +176,7 @@ func (r *indexer) run(ctx context.Context) error {
 }
 
 func (r *indexer) runWithoutWs(ctx context.Context) error {
-	lastChainBlock, err := r.ethClient.BlockNumber(ctx)
+	lastChainBlock, err := r.blockNumber(ctx)
 	if err != nil {
 		return errors.Wrap(err, "failed to get last block number")
 	}
@@ -104,18 +186,25 @@ func (r *indexer) runWithoutWs(ctx context.Context) error {
 	}
 
 	ticker := time.NewTicker(r.indexPeriod)
+	defer ticker.Stop()
 	filters := r.filters()
 
-	for range ticker.C {
-		lastChainBlock, err = r.ethClient.BlockNumber(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		lastChainBlock, err = r.checkChain(ctx)
 		if err != nil {
-			return errors.Wrap(err, "failed to get last block number")
+			return errors.Wrap(err, "failed to check chain head")
 		}
 
 		filters.FromBlock = big.NewInt(int64(r.lastBlock) + 1)
 		filters.ToBlock = big.NewInt(int64(lastChainBlock))
 
-		logs, err := r.ethClient.FilterLogs(ctx, filters)
+		logs, err := r.filterLogs(ctx, filters)
 		if err != nil {
 			return errors.Wrap(err, "failed to get filter logs")
 		}
@@ -127,78 +216,167 @@ func (r *indexer) runWithoutWs(ctx context.Context) error {
 		}
 
 		r.lastBlock = lastChainBlock
-	}
 
-	return nil
+		if err := r.releaseMatches(ctx); err != nil {
+			return errors.Wrap(err, "failed to release held matches")
+		}
+		if err := r.flushOrphans(ctx); err != nil {
+			return errors.Wrap(err, "failed to flush deferred updates")
+		}
+		if err := r.renormalize(ctx); err != nil {
+			return errors.Wrap(err, "failed to normalize amounts")
+		}
+		if err := r.expireRelayerJobs(ctx); err != nil {
+			return errors.Wrap(err, "failed to expire relayer jobs")
+		}
+	}
 }
 
+// handleUnprocessedEvents starts from r.lastBlock inclusive, because the
+// block may be processed only partially, e.g. when the subscription dropped
+// between two logs of the same block
 func (r *indexer) handleUnprocessedEvents(
 	ctx context.Context, lastChainBlock uint64,
 ) error {
 	filters := r.filters()
 
-	if r.blockRange != 0 {
-		for start := r.lastBlock + 1; start <= lastChainBlock; start += r.blockRange + 1 {
-			end := start + r.blockRange
-			if end > lastChainBlock {
-				end = lastChainBlock
-			}
+	for start := r.lastBlock; start <= lastChainBlock; start = r.lastBlock + 1 {
+		end := lastChainBlock
+		if r.blockRange != 0 && start+r.blockRange < end {
+			end = start + r.blockRange
+		}
 
-			filters.FromBlock = new(big.Int).SetUint64(start)
-			filters.ToBlock = new(big.Int).SetUint64(end)
+		filters.FromBlock = new(big.Int).SetUint64(start)
+		filters.ToBlock = new(big.Int).SetUint64(end)
 
-			logs, err := r.ethClient.FilterLogs(ctx, filters)
-			if err != nil {
-				return errors.Wrap(err, "failed to get filter logs")
-			}
+		logs, err := r.filterLogs(ctx, filters)
+		if err != nil {
+			return errors.Wrap(err, "failed to get filter logs")
+		}
 
-			for _, log := range logs {
-				if err := r.handleEvent(ctx, log); err != nil {
-					return errors.Wrap(err, "failed to handle event")
-				}
+		for _, log := range logs {
+			if err := r.handleEvent(ctx, log); err != nil {
+				return errors.Wrap(err, "failed to handle event")
 			}
 		}
-		r.lastBlock = lastChainBlock
-		return nil
+		r.lastBlock = end
 	}
 
-	filters.FromBlock = new(big.Int).SetUint64(r.lastBlock)
-	filters.ToBlock = new(big.Int).SetUint64(lastChainBlock + 1)
+	return nil
+}
 
-	logs, err := r.ethClient.FilterLogs(ctx, filters)
-	if err != nil {
-		return errors.Wrap(err, "failed to get filter logs")
-	}
+type subscription struct {
+	logs    ethereum.Subscription
+	events  chan types.Log
+	heads   ethereum.Subscription
+	headers chan *types.Header
+}
 
-	for _, log := range logs {
-		if err := r.handleEvent(ctx, log); err != nil {
-			return errors.Wrap(err, "failed to handle event")
-		}
+func (r *indexer) waitForEvents(ctx context.Context, sub subscription) error {
+	// nil channel blocks forever, so polling is disabled without hybrid mode
+	var poll <-chan time.Time
+	if r.hybrid != nil {
+		ticker := time.NewTicker(r.indexPeriod)
+		defer ticker.Stop()
+		poll = ticker.C
 	}
-	r.lastBlock = lastChainBlock
 
-	return nil
-}
+	check := time.NewTicker(r.indexPeriod)
+	defer check.Stop()
 
-func (r *indexer) waitForEvents(
-	ctx context.Context, sub ethereum.Subscription, events <-chan types.Log,
-) error {
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case err := <-sub.Err():
-			return errors.Wrap(err, "log subscription failed")
-		case event := <-events:
+		case <-check.C:
+			if err := r.checkSubscription(ctx); err != nil {
+				return err
+			}
+			if err := r.releaseMatches(ctx); err != nil {
+				return errors.Wrap(err, "failed to release held matches")
+			}
+			if err := r.flushOrphans(ctx); err != nil {
+				return errors.Wrap(err, "failed to flush deferred updates")
+			}
+			if err := r.renormalize(ctx); err != nil {
+				return errors.Wrap(err, "failed to normalize amounts")
+			}
+			if err := r.expireRelayerJobs(ctx); err != nil {
+				return errors.Wrap(err, "failed to expire relayer jobs")
+			}
+		case <-poll:
+			if err := r.pollMissedEvents(ctx); err != nil {
+				return errors.Wrap(err, "failed to poll missed events")
+			}
+		case err := <-sub.logs.Err():
+			return subscriptionErr(err)
+		case err := <-sub.heads.Err():
+			return subscriptionErr(err)
+		case header := <-sub.headers:
+			if n := header.Number.Uint64(); n > r.watchdog.wsHead {
+				r.watchdog.wsHead = n
+			}
+		case event := <-sub.events:
 			if err := r.handleEvent(ctx, event); err != nil {
 				return errors.Wrap(err, "failed to handle event")
 			}
-			r.lastBlock = event.BlockNumber
+			if event.BlockNumber > r.lastBlock {
+				r.lastBlock = event.BlockNumber
+			}
 		}
 	}
 }
 
+func subscriptionErr(err error) error {
+	reason := "subscription closed"
+	if err != nil {
+		reason = err.Error()
+	}
+	return errors.From(errSubscriptionFailed, logan.F{"reason": reason})
+}
+
+// handleEvent is not started after ctx is done, but once started it is
+// finished with r.writes, so the collector never sees a half-handled event
 func (r *indexer) handleEvent(ctx context.Context, log types.Log) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.writes != nil {
+		ctx = r.writes
+	}
+
+	if log.Removed {
+		r.log.WithFields(logan.F{
+			"block":     log.BlockNumber,
+			"log_index": log.Index,
+		}).Warn("received removed log due to chain reorganization, skipping it")
+		return r.unarchiveLog(log)
+	}
+	if r.lastApplied != nil && !r.lastApplied.isBefore(log) || r.wasApplied(log) {
+		r.log.WithFields(logan.F{
+			"block":     log.BlockNumber,
+			"log_index": log.Index,
+		}).Debug("log was already applied, skipping it")
+		return nil
+	}
+
+	ctx = sink.WithPosition(ctx, log.BlockNumber, log.Index)
+	if err := r.applyEvent(ctx, log); err != nil {
+		return err
+	}
+
+	if err := r.updateLastBlock(ctx, r.checkpointBlock(log.BlockNumber)); err != nil {
+		return errors.Wrap(err, "failed to update last block")
+	}
+	r.lastApplied = &logPosition{block: log.BlockNumber, index: log.Index}
+	r.rememberApplied(log)
+
+	return nil
+}
+
+// applyEvent calls the handler of the event without any checks and without
+// moving the last block, then archives the event
+func (r *indexer) applyEvent(ctx context.Context, log types.Log) error {
 	topic := log.Topics[0] // First topic must be a hashed signature of the event
 
 	event, err := r.swapicaAbi.EventByID(topic)
@@ -223,9 +401,16 @@ func (r *indexer) handleEvent(ctx context.Context, log types.Log) error {
 		})
 	}
 
-	if err := r.updateLastBlock(ctx, log.BlockNumber); err != nil {
-		return errors.Wrap(err, "failed to update last block")
-	}
+	return r.archiveLog(ctx, event.Name, log)
+}
 
-	return nil
+// logPosition points to the last applied log and is used to skip the logs
+// received from both backfill and subscription
+type logPosition struct {
+	block uint64
+	index uint
+}
+
+func (p logPosition) isBefore(log types.Log) bool {
+	return p.block < log.BlockNumber || p.block == log.BlockNumber && p.index < log.Index
 }
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/Swapica/indexer-svc/internal/gobind"
+	"github.com/Swapica/indexer-svc/internal/service/requests"
+	"github.com/Swapica/indexer-svc/internal/store"
+	"github.com/Swapica/order-aggregator-svc/resources"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// The local store is written after the collector, so it never has entities
+// the collector failed to save. All the methods are no-op without the store.
+
+func (r *indexer) storeOrder(ctx context.Context, o gobind.ISwapicaOrder, useRelayer bool) error {
+	if r.store == nil {
+		return nil
+	}
+
+	order := newStoreOrder(o, useRelayer)
+	order.Normalized = r.normalizeOrder(ctx, order)
+	err := r.store.PutOrder(order)
+	return errors.Wrap(err, "failed to put order into local store")
+}
+
+func newStoreOrder(o gobind.ISwapicaOrder, useRelayer bool) store.Order {
+	matchID, matchSwapica := requests.OrderMatch(o.Status)
+	return store.Order{
+		OrderID:          o.OrderId.Int64(),
+		Creator:          o.Creator.String(),
+		TokenToSell:      o.TokenToSell.String(),
+		AmountToSell:     o.AmountToSell.String(),
+		TokenToBuy:       o.TokenToBuy.String(),
+		AmountToBuy:      o.AmountToBuy.String(),
+		DestinationChain: o.DestinationChain.Int64(),
+		State:            o.Status.State,
+		MatchID:          matchID,
+		MatchSwapica:     matchSwapica,
+		UseRelayer:       useRelayer,
+	}
+}
+
+func (r *indexer) storeOrderStatus(id *big.Int, status gobind.ISwapicaOrderStatus) error {
+	if r.store == nil {
+		return nil
+	}
+
+	matchID, matchSwapica := requests.OrderMatch(status)
+	err := r.store.UpdateOrder(id.Int64(), status.State, matchID, matchSwapica)
+	return errors.Wrap(err, "failed to update order in local store")
+}
+
+func (r *indexer) storeMatch(ctx context.Context, m gobind.ISwapicaMatch, useRelayer bool) error {
+	if r.store == nil {
+		return nil
+	}
+
+	match := newStoreMatch(m, useRelayer)
+	match.Normalized = r.normalizeMatch(ctx, match)
+	err := r.store.PutMatch(match)
+	return errors.Wrap(err, "failed to put match into local store")
+}
+
+func newStoreMatch(m gobind.ISwapicaMatch, useRelayer bool) store.Match {
+	return store.Match{
+		MatchID:       m.MatchId.Int64(),
+		Creator:       m.Creator.String(),
+		TokenToSell:   m.TokenToSell.String(),
+		AmountToSell:  m.AmountToSell.String(),
+		OriginChain:   m.OriginChainId.Int64(),
+		OriginOrderID: m.OriginOrderId.Int64(),
+		State:         m.State,
+		UseRelayer:    useRelayer,
+	}
+}
+
+func (r *indexer) storeMatchState(id *big.Int, state uint8) error {
+	if r.store == nil {
+		return nil
+	}
+
+	err := r.store.UpdateMatch(id.Int64(), state)
+	return errors.Wrap(err, "failed to update match in local store")
+}
+
+func (r *indexer) storedOrder(id int64) (store.Order, bool) {
+	if r.store == nil {
+		return store.Order{}, false
+	}
+	return r.store.Order(id)
+}
+
+func (r *indexer) storedMatch(id int64) (store.Match, bool) {
+	if r.store == nil {
+		return store.Match{}, false
+	}
+	return r.store.Match(id)
+}
+
+// bootstrapStore fills the store enabled on an existing deployment, the
+// events before the checkpoint are never handled again. The entities are read
+// from the contract and use_relayer flags from the collector, the entities
+// the collector does not have yet are rewritten when their events are handled.
+func (r *indexer) bootstrapStore(ctx context.Context) error {
+	if r.store == nil || r.store.Bootstrapped() {
+		return nil
+	}
+	r.log.Info("bootstrapping local store from the contract")
+
+	orders, err := listCollected[resources.Order](ctx, r.collector, r.chainID, "/orders")
+	if err != nil {
+		return errors.Wrap(err, "failed to list orders in collector")
+	}
+	orderFlags := make(map[int64]bool, len(orders))
+	for _, o := range orders {
+		orderFlags[o.Attributes.OrderId] = o.Attributes.UseRelayer
+	}
+	err = r.forEachContractOrder(ctx, func(o gobind.ISwapicaOrder) error {
+		return r.storeOrder(ctx, o, orderFlags[o.OrderId.Int64()])
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to store contract orders")
+	}
+
+	matches, err := listCollected[resources.Match](ctx, r.collector, r.chainID, "/match_orders")
+	if err != nil {
+		return errors.Wrap(err, "failed to list matches in collector")
+	}
+	matchFlags := make(map[int64]bool, len(matches))
+	for _, m := range matches {
+		matchFlags[m.Attributes.MatchId] = m.Attributes.UseRelayer
+	}
+	err = r.forEachContractMatch(ctx, func(m gobind.ISwapicaMatch) error {
+		return r.storeMatch(ctx, m, matchFlags[m.MatchId.Int64()])
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to store contract matches")
+	}
+
+	return errors.Wrap(r.store.MarkBootstrapped(), "failed to mark local store bootstrapped")
+}
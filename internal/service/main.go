@@ -4,10 +4,17 @@ import (
 	"context"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
+	"github.com/Swapica/indexer-svc/internal/api"
 	"github.com/Swapica/indexer-svc/internal/config"
+	"github.com/Swapica/indexer-svc/internal/sink"
+	"github.com/Swapica/indexer-svc/internal/stream"
+	"github.com/Swapica/indexer-svc/internal/webhook"
 	"github.com/Swapica/order-aggregator-svc/resources"
 	"gitlab.com/distributed_lab/json-api-connector/cerrors"
 	"gitlab.com/distributed_lab/logan/v3"
@@ -15,63 +22,246 @@ import (
 	"gitlab.com/distributed_lab/running"
 )
 
+// streamBacklogSize is the number of recent events kept to resume the stream
+const streamBacklogSize = 1000
+
 type service struct {
 	log *logan.Entry
 	cfg config.Config
+	// collector is used by the indexers of the running service instead of the
+	// configured one, it skips or records the writes
+	collector sink.Collector
+	dryRun    bool
 }
 
-func (s *service) run() error {
+// ErrShutdownTimeout is returned when the writes in progress were not
+// finished within the shutdown grace period
+var ErrShutdownTimeout = errors.New("shutdown grace period is over")
+
+// run returns after ctx is done and the writes in progress are finished
+func (s *service) run(ctx context.Context) error {
 	s.log.Info("Service started")
 
-	last, err := s.getLastBlock()
+	last, err := s.getLastBlock(ctx)
 	if err != nil {
 		return errors.Wrap(err, "failed to get last block")
 	}
 
+	closeSink, err := s.setupSink()
+	if err != nil {
+		return errors.Wrap(err, "failed to set up collector sink")
+	}
+	defer closeSink()
+
+	writes, cancelWrites := graceContext(ctx, s.cfg.Network().ShutdownGrace)
+	defer cancelWrites()
+
 	runner := newIndexer(s.cfg, last)
+	runner.collector = s.collector
+	runner.writes = writes
+	if s.dryRun {
+		// The archive and the local store are shared with the indexer writing
+		// to the collector, they must not get the events it has not applied
+		runner.archive, runner.store = nil, nil
+	}
+	if err = runner.bootstrapStore(ctx); err != nil {
+		return errors.Wrap(err, "failed to bootstrap local store")
+	}
+
+	// Webhooks and relayer jobs would announce the entities the collector
+	// does not have in dry run
+	var hooks *webhook.Dispatcher
+	if wh := s.cfg.Webhooks(); wh.Enabled && !s.dryRun {
+		hooks, err = webhook.NewDispatcher(s.log, wh.Opts, wh.Subscriptions)
+		if err != nil {
+			return errors.Wrap(err, "failed to create webhook dispatcher")
+		}
+		runner.listeners = append(runner.listeners, hooks)
+		go hooks.Run(writes)
+	}
+
+	if queue := s.cfg.RelayerQueue(); queue != nil && !s.dryRun {
+		runner.jobs = &relayerJobs{r: runner, queue: queue}
+		runner.listeners = append(runner.listeners, runner.jobs)
+	}
+
+	if cc := s.cfg.CrossCheck(); cc.Period != 0 {
+		go s.runCrossCheck(ctx, cc.Period, cc.Chains)
+	}
+	if addr := s.cfg.API().Addr; addr != "" {
+		broker := stream.NewBroker(streamBacklogSize)
+		runner.listeners = append(runner.listeners, broker)
+		go api.Run(ctx, s.log, addr, s.cfg.LocalStore(), broker, s.cfg.Network().ChainID)
+	}
+	go s.serveAdmin(ctx, hooks, runner.listeners)
 
 	if s.cfg.Network().WsClient != nil {
 		running.WithBackOff(
-			context.Background(), s.log, "indexer",
+			ctx, s.log, "indexer",
 			runner.run,
 			s.cfg.Network().IndexPeriod, s.cfg.Network().IndexPeriod, 10*time.Minute)
 	} else {
 		running.WithBackOff(
-			context.Background(), s.log, "indexer",
+			ctx, s.log, "indexer",
 			runner.runWithoutWs,
 			s.cfg.Network().IndexPeriod, s.cfg.Network().IndexPeriod, 10*time.Minute)
 	}
 
-	return nil
+	return s.shutdown(writes, hooks, runner.lastBlock)
+}
+
+// shutdown is called after the indexer is stopped, it waits for the webhook
+// deliveries within the rest of the grace period and closes the archive and
+// the local store
+func (s *service) shutdown(writes context.Context, hooks *webhook.Dispatcher, lastBlock uint64) error {
+	s.log.WithField("last_block", lastBlock).Info("indexer stopped, finishing the writes")
+
+	var err error
+	if writes.Err() != nil {
+		s.log.Error("events in progress were interrupted by the shutdown grace period")
+		err = ErrShutdownTimeout
+	}
+	if hooks != nil {
+		if ferr := hooks.Flush(writes); ferr != nil {
+			s.log.WithError(ferr).Error("failed to finish webhook deliveries")
+			err = ErrShutdownTimeout
+		}
+	}
+	if a := s.cfg.EventArchive(); a != nil {
+		if cerr := a.Close(); cerr != nil && err == nil {
+			err = errors.Wrap(cerr, "failed to close event archive")
+		}
+	}
+	if st := s.cfg.LocalStore(); st != nil {
+		if cerr := st.Close(); cerr != nil && err == nil {
+			err = errors.Wrap(cerr, "failed to close local store")
+		}
+	}
+
+	if err == nil {
+		s.log.Info("Service stopped")
+	}
+	return err
+}
+
+// setupSink wraps the collector to skip the writes in dry run and to record
+// them when sink.record is set, the returned func closes the files
+func (s *service) setupSink() (func(), error) {
+	var files []*sink.Log
+	closeFiles := func() {
+		for _, f := range files {
+			if err := f.Close(); err != nil {
+				s.log.WithError(err).Error("failed to close write log")
+			}
+		}
+	}
+
+	cfg := s.cfg.Sink()
+	if s.dryRun {
+		var skipped sink.Appender = sink.LogEntries(s.log)
+		if cfg.DryRunOutput != "" {
+			f, err := sink.OpenLog(cfg.DryRunOutput)
+			if err != nil {
+				return closeFiles, errors.Wrap(err, "failed to open dry run output")
+			}
+			files = append(files, f)
+			skipped = f
+		}
+		s.collector = sink.NewShadow(s.collector, skipped, sink.ShadowOpts{
+			ChainID:  s.cfg.Network().ChainID,
+			Fallback: true,
+		})
+		s.log.WithField("output", cfg.DryRunOutput).Warn("dry run, collector writes are skipped")
+	}
+
+	if cfg.Record != "" {
+		f, err := sink.OpenLog(cfg.Record)
+		if err != nil {
+			return closeFiles, errors.Wrap(err, "failed to open write record")
+		}
+		files = append(files, f)
+		s.collector = sink.NewRecorder(s.collector, f)
+	}
+
+	return closeFiles, nil
 }
 
 func newService(cfg config.Config) *service {
 	return &service{
-		log: cfg.Log().WithField("chain", cfg.Network().ChainID),
-		cfg: cfg,
+		log:       cfg.Log().WithField("chain", cfg.Network().ChainID),
+		cfg:       cfg,
+		collector: cfg.Collector(),
 	}
 }
 
-func Run(cfg config.Config) {
-	if err := newService(cfg).run(); err != nil {
-		panic(err)
+// Run runs the service until SIGINT or SIGTERM, dryRun is combined with
+// sink.dry_run. The error is nil when the service stopped cleanly.
+func Run(cfg config.Config, dryRun bool) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := newService(cfg)
+	s.dryRun = dryRun || cfg.Sink().DryRun
+	return s.run(ctx)
+}
+
+func (s *service) getLastBlock(ctx context.Context) (uint64, error) {
+	n, found, err := s.getCheckpoint(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return s.getStartBlock(ctx)
 	}
+	return n, nil
 }
 
-func (s *service) getLastBlock() (uint64, error) {
+// getCheckpoint returns the last block saved in the collector, found is false
+// when there is no such record yet
+func (s *service) getCheckpoint(ctx context.Context) (n uint64, found bool, err error) {
 	// No error can occur when parsing int64 + const_string
 	path, _ := url.Parse(strconv.FormatInt(s.cfg.Network().ChainID, 10) + "/block")
 
 	var resp resources.BlockResponse
-	if err := s.cfg.Collector().Get(path, &resp); err != nil {
+	if err := s.cfg.Collector().Get(ctx, path, &resp); err != nil {
 		if err, ok := err.(cerrors.Error); ok && err.Status() == http.StatusNotFound {
-			s.log.WithField("default_last_block", s.cfg.Network().OverrideLastBlock).
-				Warn("last block should be set either in orders DB or in override_last_block config field, using default")
-			return s.cfg.Network().OverrideLastBlock, nil
+			return 0, false, nil
 		}
-		return 0, errors.Wrap(err, "failed to get last block from collector")
+		return 0, false, errors.Wrap(err, "failed to get last block from collector")
 	}
 
-	n, err := strconv.ParseUint(resp.Data.ID, 10, 64)
-	return n, errors.Wrap(err, "failed to parse received block number", map[string]interface{}{"data.id": resp.Data.ID})
+	n, err = strconv.ParseUint(resp.Data.ID, 10, 64)
+	return n, true, errors.Wrap(err, "failed to parse received block number", map[string]interface{}{"data.id": resp.Data.ID})
+}
+
+// getStartBlock is used when the collector has no block record: the
+// override_last_block has the priority, then start_time, then the block where
+// the contract was deployed
+func (s *service) getStartBlock(ctx context.Context) (uint64, error) {
+	network := s.cfg.Network()
+	if network.OverrideLastBlock != 0 {
+		s.log.WithField("override_last_block", network.OverrideLastBlock).
+			Warn("last block is not set in orders DB, using override_last_block")
+		return network.OverrideLastBlock, nil
+	}
+
+	if network.StartTime != nil {
+		n, err := findBlockByTime(ctx, network.EthClient, network.Retry, *network.StartTime)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to find block by start_time")
+		}
+		s.log.WithFields(logan.F{
+			"start_time":  network.StartTime.Format(time.RFC3339),
+			"start_block": n,
+		}).Warn("last block is not set in orders DB, starting from start_time")
+		return n, nil
+	}
+
+	n, err := findDeploymentBlock(ctx, network.EthClient, network.Retry, network.ContractAddress)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to find contract deployment block, set override_last_block or start_time")
+	}
+	s.log.WithField("start_block", n).
+		Warn("last block is not set in orders DB, starting from contract deployment")
+	return n, nil
 }
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Swapica/indexer-svc/internal/gobind"
+	"github.com/Swapica/indexer-svc/internal/metrics"
+	"github.com/Swapica/indexer-svc/internal/sink"
+	"github.com/Swapica/order-aggregator-svc/resources"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// originContracts keeps the contracts of the other chains used to verify the
+// origin orders, they are dialed on the first use
+type originContracts struct {
+	mu        sync.Mutex
+	contracts map[int64]*gobind.Swapica
+}
+
+func newOriginContracts() *originContracts {
+	return &originContracts{contracts: make(map[int64]*gobind.Swapica)}
+}
+
+// heldMatch is the match created before its origin order was indexed
+type heldMatch struct {
+	log        types.Log
+	match      gobind.ISwapicaMatch
+	useRelayer bool
+	since      time.Time
+	// unverified is set when the origin order was not found in its chain
+	// contract after the timeout
+	unverified bool
+}
+
+// holdMatch postpones adding the match until its origin order is in the
+// collector, so the match is linked to it. The held matches are released by
+// releaseMatches without blocking the events after them. It reports whether
+// the match was held.
+func (r *indexer) holdMatch(ctx context.Context, m gobind.ISwapicaMatch, useRelayer bool, log types.Log) (bool, error) {
+	if _, ok := r.held[m.MatchId.Int64()]; ok {
+		return true, nil
+	}
+
+	chainID, orderID := m.OriginChainId.Int64(), m.OriginOrderId.Int64()
+	exists, err := r.chainOrderExists(ctx, chainID, orderID)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check if origin order exists")
+	}
+	if exists {
+		return false, nil
+	}
+
+	r.held[m.MatchId.Int64()] = &heldMatch{log: log, match: m, useRelayer: useRelayer, since: time.Now()}
+	metrics.OriginWaits.Add("held", 1)
+	r.log.WithFields(logan.F{
+		"match_id":        m.MatchId.String(),
+		"origin_chain":    chainID,
+		"origin_order_id": orderID,
+		"timeout":         r.originWaitTimeout.String(),
+	}).Warn("origin order is not indexed yet, holding match")
+	return true, nil
+}
+
+// releaseMatches adds the held matches whose origin orders are indexed. After
+// the timeout the match is added anyway. When the fallback is enabled, it is
+// added only if its origin order is found in the contract of its chain, and
+// is held otherwise.
+func (r *indexer) releaseMatches(ctx context.Context) error {
+	if len(r.held) == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.writes != nil {
+		ctx = r.writes
+	}
+
+	held := make([]*heldMatch, 0, len(r.held))
+	for _, h := range r.held {
+		held = append(held, h)
+	}
+	sort.Slice(held, func(i, j int) bool {
+		return logPosition{block: held[i].log.BlockNumber, index: held[i].log.Index}.isBefore(held[j].log)
+	})
+
+	released := false
+	for _, h := range held {
+		chainID, orderID := h.match.OriginChainId.Int64(), h.match.OriginOrderId.Int64()
+		log := r.log.WithFields(logan.F{
+			"match_id":        h.match.MatchId.String(),
+			"origin_chain":    chainID,
+			"origin_order_id": orderID,
+			"waited":          time.Since(h.since).String(),
+		})
+
+		exists, err := r.chainOrderExists(ctx, chainID, orderID)
+		if err != nil {
+			return errors.Wrap(err, "failed to check if origin order exists")
+		}
+
+		switch {
+		case exists:
+			metrics.OriginWaits.Add("resolved", 1)
+			log.Info("origin order indexed, releasing match")
+		case time.Since(h.since) < r.originWaitTimeout:
+			continue
+		case !r.originFallback:
+			metrics.OriginWaits.Add("timed_out", 1)
+			log.Warn("origin order is still not indexed, adding match without it")
+		default:
+			if err = r.verifyOriginOrder(ctx, chainID, orderID); err != nil {
+				if !h.unverified {
+					h.unverified = true
+					metrics.OriginWaits.Add("unverified", 1)
+					log.WithError(err).Warn("failed to find origin order in its chain contract, still holding match")
+				}
+				continue
+			}
+			metrics.OriginWaits.Add("verified", 1)
+			log.Info("origin order found in its chain contract, adding match before it is indexed")
+		}
+
+		if err = r.releaseMatch(ctx, h); err != nil {
+			return errors.Wrap(err, "failed to release match", logan.F{"match_id": h.match.MatchId.String()})
+		}
+		released = true
+	}
+
+	if !released || r.lastApplied == nil {
+		return nil
+	}
+	return errors.Wrap(r.updateLastBlock(ctx, r.checkpointBlock(r.lastApplied.block)), "failed to update last block")
+}
+
+// releaseMatch makes the writes of the match creation at the position of its
+// log, the updates of the match received meanwhile were deferred until it
+func (r *indexer) releaseMatch(ctx context.Context, h *heldMatch) error {
+	ctx = sink.WithPosition(ctx, h.log.BlockNumber, h.log.Index)
+	key := entityKey{entity: EntityMatch, id: h.match.MatchId.Int64()}
+
+	if err := r.addOrPushMatch(ctx, h.match, h.useRelayer, &h.log); err != nil {
+		return err
+	}
+	if err := r.applyOrphans(ctx, key); err != nil {
+		return err
+	}
+
+	// the match stays held on failures, so it is released again
+	delete(r.held, key.id)
+	return nil
+}
+
+// checkpointBlock keeps the checkpoint at the earliest held match or deferred
+// update, so they are handled again when the indexer is restarted
+func (r *indexer) checkpointBlock(block uint64) uint64 {
+	for _, h := range r.held {
+		if h.log.BlockNumber < block {
+			block = h.log.BlockNumber
+		}
+	}
+	for _, logs := range r.orphans.logs {
+		for _, log := range logs {
+			if log.BlockNumber < block {
+				block = log.BlockNumber
+			}
+		}
+	}
+	return block
+}
+
+func (r *indexer) chainOrderExists(ctx context.Context, chainID, orderID int64) (bool, error) {
+	o, err := r.getChainOrder(ctx, chainID, orderID)
+	return o != nil, err
+}
+
+// getChainOrder returns the order of any chain from the collector, it returns
+// nil when the order is not found
+func (r *indexer) getChainOrder(ctx context.Context, chainID, orderID int64) (*resources.Order, error) {
+	u, _ := url.Parse("/orders")
+	q := u.Query()
+	q.Set("filter[src_chain]", strconv.FormatInt(chainID, 10))
+	q.Set("filter[order_id]", strconv.FormatInt(orderID, 10))
+	u.RawQuery = q.Encode()
+
+	var resp resources.OrderListResponse
+	if err := r.collector.Get(ctx, u, &resp); err != nil {
+		return nil, errors.Wrap(err, "failed to get orders from collector")
+	}
+	for _, o := range resp.Data {
+		if o.Attributes.OrderId == orderID {
+			return &o, nil
+		}
+	}
+	return nil, nil
+}
+
+// verifyOriginOrder checks that the order exists in the contract of its
+// chain. The order is not added to the collector: its use_relayer flag is
+// known only from the creation event, so it is left to the indexer of that
+// chain.
+func (r *indexer) verifyOriginOrder(ctx context.Context, chainID, orderID int64) error {
+	swapica, err := r.origins.get(ctx, r, chainID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get origin chain contract")
+	}
+
+	_, err = r.contractOrder(ctx, swapica, orderID)
+	return errors.Wrap(err, "failed to get origin order")
+}
+
+func (c *originContracts) get(ctx context.Context, r *indexer, chainID int64) (*gobind.Swapica, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.contracts[chainID]; ok {
+		return s, nil
+	}
+
+	chain, err := r.getChain(ctx, chainID)
+	if err != nil {
+		return nil, err
+	}
+	if chain.Attributes.ChainParams.Rpc == nil {
+		return nil, errors.From(errors.New("chain has no rpc in collector"), logan.F{"chain_id": chainID})
+	}
+
+	cli, err := ethclient.Dial(*chain.Attributes.ChainParams.Rpc)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to origin chain RPC", logan.F{"chain_id": chainID})
+	}
+	s, err := gobind.NewSwapica(common.HexToAddress(chain.Attributes.SwapContract), cli)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create contract caller", logan.F{"chain_id": chainID})
+	}
+
+	c.contracts[chainID] = s
+	return s, nil
+}
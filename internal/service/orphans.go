@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/Swapica/indexer-svc/internal/gobind"
+	"github.com/Swapica/indexer-svc/internal/metrics"
+	"github.com/Swapica/indexer-svc/internal/service/state"
+	"github.com/Swapica/indexer-svc/internal/sink"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gitlab.com/distributed_lab/json-api-connector/cerrors"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// maxOrphanUpdates limits the updates kept for the entities that are not
+// created yet, the updates over it are dropped as illegal transitions
+const maxOrphanUpdates = 1000
+
+// orphanTimeout is how long the updates wait for the creation, the poller
+// finds the missed creations well before it
+const orphanTimeout = 5 * time.Minute
+
+// errNotCreated is returned by the updates of the entities the collector does
+// not have
+var errNotCreated = errors.New("entity is not created yet")
+
+type entityKey struct {
+	entity string
+	id     int64
+}
+
+// orphanUpdates keeps the updates of the orders and matches that are not
+// created yet, they are applied right after the creation. An update comes
+// first when the poller finds the missed creation after the subscription
+// delivered the update, or when the match is held until its origin order.
+// The updates of the entities created before the start block never get
+// their creation, so they are patched directly after orphanTimeout. The
+// checkpoint is kept at the earliest update, so they survive a restart.
+type orphanUpdates struct {
+	count int
+	logs  map[entityKey][]types.Log
+	since map[entityKey]time.Time
+}
+
+func newOrphanUpdates() *orphanUpdates {
+	return &orphanUpdates{
+		logs:  make(map[entityKey][]types.Log),
+		since: make(map[entityKey]time.Time),
+	}
+}
+
+func (r *indexer) deferUpdate(key entityKey, to state.State, log types.Log) {
+	entry := r.log.WithFields(logan.F{
+		"entity":    key.entity,
+		"id":        key.id,
+		"state":     to.String(),
+		"block":     log.BlockNumber,
+		"log_index": log.Index,
+	})
+
+	if r.orphans.count >= maxOrphanUpdates {
+		metrics.Anomalies.Add(metrics.TransitionKey(key.entity, state.None.String(), to.String()), 1)
+		entry.Warn("too many updates of entities that are not created, dropping update")
+		return
+	}
+
+	if _, ok := r.orphans.since[key]; !ok {
+		r.orphans.since[key] = time.Now()
+	}
+	r.orphans.logs[key] = append(r.orphans.logs[key], log)
+	r.orphans.count++
+	entry.Warn("entity is not created yet, deferring update until its creation")
+}
+
+// applyOrphans applies the deferred updates of the just created entity in
+// the order of their logs
+func (r *indexer) applyOrphans(ctx context.Context, key entityKey) error {
+	logs := r.orphans.logs[key]
+	if len(logs) == 0 {
+		return nil
+	}
+	delete(r.orphans.logs, key)
+	delete(r.orphans.since, key)
+	r.orphans.count -= len(logs)
+
+	sort.Slice(logs, func(i, j int) bool {
+		return logPosition{block: logs[i].BlockNumber, index: logs[i].Index}.isBefore(logs[j])
+	})
+
+	handle, eventName := r.handleOrderUpdated, "OrderUpdated"
+	if key.entity == EntityMatch {
+		handle, eventName = r.handleMatchUpdated, "MatchUpdated"
+	}
+	for i := range logs {
+		log := logs[i]
+		if err := handle(sink.WithPosition(ctx, log.BlockNumber, log.Index), eventName, &log); err != nil {
+			// the rest is applied when the creation is handled again
+			r.orphans.logs[key] = logs[i:]
+			r.orphans.since[key] = time.Now()
+			r.orphans.count += len(logs) - i
+			return errors.Wrap(err, "failed to apply deferred update", logan.F{
+				"block":     log.BlockNumber,
+				"log_index": log.Index,
+			})
+		}
+	}
+	return nil
+}
+
+// flushOrphans applies the updates waiting for the creation longer than
+// orphanTimeout. The updates of the entities the collector has got meanwhile
+// go through the handlers, the others are patched directly when the contract
+// has the entity, and dropped otherwise.
+func (r *indexer) flushOrphans(ctx context.Context) error {
+	if r.orphans.count == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.writes != nil {
+		ctx = r.writes
+	}
+
+	flushed := false
+	for key, since := range r.orphans.since {
+		if time.Since(since) < orphanTimeout {
+			continue
+		}
+		// the updates of the held match are applied when it is released
+		if _, ok := r.held[key.id]; ok && key.entity == EntityMatch {
+			continue
+		}
+
+		if err := r.flushOrphan(ctx, key); err != nil {
+			return errors.Wrap(err, "failed to apply deferred updates", logan.F{
+				"entity": key.entity,
+				"id":     key.id,
+			})
+		}
+		flushed = true
+	}
+
+	if !flushed || r.lastApplied == nil {
+		return nil
+	}
+	return errors.Wrap(r.updateLastBlock(ctx, r.checkpointBlock(r.lastApplied.block)), "failed to update last block")
+}
+
+func (r *indexer) flushOrphan(ctx context.Context, key entityKey) error {
+	var created bool
+	if key.entity == EntityMatch {
+		m, err := r.getMatch(ctx, key.id)
+		if err != nil {
+			return err
+		}
+		created = m != nil
+	} else {
+		o, err := r.getOrder(ctx, key.id)
+		if err != nil {
+			return err
+		}
+		created = o != nil
+	}
+	if created {
+		return r.applyOrphans(ctx, key)
+	}
+
+	logs := r.orphans.logs[key]
+	entry := r.log.WithFields(logan.F{
+		"entity":  key.entity,
+		"id":      key.id,
+		"updates": len(logs),
+	})
+
+	orders, matches, err := r.contractLengths(ctx)
+	if err != nil {
+		return err
+	}
+	length := orders
+	if key.entity == EntityMatch {
+		length = matches
+	}
+	if key.id < 1 || key.id > length {
+		r.dropOrphans(key)
+		entry.Warn("entity of deferred updates is not in the contract, dropping updates")
+		return nil
+	}
+
+	sort.Slice(logs, func(i, j int) bool {
+		return logPosition{block: logs[i].BlockNumber, index: logs[i].Index}.isBefore(logs[j])
+	})
+	for i := range logs {
+		if err = r.patchOrphan(sink.WithPosition(ctx, logs[i].BlockNumber, logs[i].Index), key, &logs[i]); err != nil {
+			if cerrors.NotFound(errors.Cause(err)) {
+				r.dropOrphans(key)
+				entry.WithError(err).Warn("entity is not in collector, dropping deferred updates")
+				return nil
+			}
+			return err
+		}
+	}
+
+	r.dropOrphans(key)
+	entry.Warn("entity creation was not indexed, deferred updates patched directly")
+	return nil
+}
+
+// patchOrphan writes the update without checking the state transition, the
+// current state is unknown
+func (r *indexer) patchOrphan(ctx context.Context, key entityKey, log *types.Log) error {
+	id := big.NewInt(key.id)
+	if key.entity == EntityMatch {
+		var event gobind.SwapicaMatchUpdated
+		if err := r.swapicaAbi.UnpackIntoInterface(&event, "MatchUpdated", log.Data); err != nil {
+			return errors.Wrap(err, "failed to unpack event")
+		}
+		if err := r.patchMatch(ctx, id, event.Status); err != nil {
+			return err
+		}
+		return r.publish(ctx, r.newMatchUpdated(id, event.Status, log))
+	}
+
+	var event gobind.SwapicaOrderUpdated
+	if err := r.swapicaAbi.UnpackIntoInterface(&event, "OrderUpdated", log.Data); err != nil {
+		return errors.Wrap(err, "failed to unpack event")
+	}
+	if err := r.patchOrder(ctx, id, event.Status); err != nil {
+		return err
+	}
+	return r.publish(ctx, r.newOrderUpdated(id, event.Status, log))
+}
+
+func (r *indexer) dropOrphans(key entityKey) {
+	r.orphans.count -= len(r.orphans.logs[key])
+	delete(r.orphans.logs, key)
+	delete(r.orphans.since, key)
+}
+
+// contractLengths returns the numbers of the orders and the matches in the
+// contract, the IDs are assigned sequentially from 1
+func (r *indexer) contractLengths(ctx context.Context) (orders, matches int64, err error) {
+	var n *big.Int
+	err = r.rpc(ctx, func(ctx context.Context) (err error) {
+		n, err = r.swapica.GetAllOrdersLength(&bind.CallOpts{Context: ctx})
+		return err
+	})
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to get orders length")
+	}
+	orders = n.Int64()
+
+	err = r.rpc(ctx, func(ctx context.Context) (err error) {
+		n, err = r.swapica.GetAllMatchesLength(&bind.CallOpts{Context: ctx})
+		return err
+	})
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to get matches length")
+	}
+	return orders, n.Int64(), nil
+}
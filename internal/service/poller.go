@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/Swapica/indexer-svc/internal/metrics"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// hybridPoller re-reads logs of the blocks that had to be delivered by the
+// subscription already, so the logs silently dropped by the provider are
+// applied with a delay of index_period instead of being lost
+type hybridPoller struct {
+	// polledBlock is the last block checked with FilterLogs
+	polledBlock uint64
+	// completedBlock is the head observed on the previous tick: the
+	// subscription had the whole index_period to deliver its logs
+	completedBlock uint64
+	applied        map[logPosition]struct{}
+}
+
+func newHybridPoller() *hybridPoller {
+	return &hybridPoller{applied: make(map[logPosition]struct{})}
+}
+
+// resetPoller is called after backfill, because all the logs up to
+// lastChainBlock were received with FilterLogs. The backfill starts at the
+// last block delivered by the subscription, so after a resubscription the
+// blocks before it are still polled: a log dropped there is followed by the
+// delivered ones. The logs already applied are skipped by the poller.
+func (r *indexer) resetPoller(lastChainBlock uint64) {
+	if r.hybrid == nil {
+		return
+	}
+	if r.hybrid.completedBlock == 0 {
+		r.hybrid.polledBlock = lastChainBlock
+	}
+	r.hybrid.completedBlock = lastChainBlock
+}
+
+func (r *indexer) rememberApplied(log types.Log) {
+	if r.hybrid == nil {
+		return
+	}
+	r.hybrid.applied[logPosition{block: log.BlockNumber, index: log.Index}] = struct{}{}
+}
+
+// wasApplied reports whether the log is among the recently applied ones, e.g.
+// it was applied by the poller before the subscription delivered it
+func (r *indexer) wasApplied(log types.Log) bool {
+	if r.hybrid == nil {
+		return false
+	}
+	_, ok := r.hybrid.applied[logPosition{block: log.BlockNumber, index: log.Index}]
+	return ok
+}
+
+func (r *indexer) pollMissedEvents(ctx context.Context) error {
+	head, err := r.blockNumber(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get last block number")
+	}
+
+	p := r.hybrid
+	filters := r.filters()
+
+	for start := p.polledBlock + 1; start <= p.completedBlock; start = p.polledBlock + 1 {
+		end := p.completedBlock
+		if r.blockRange != 0 && start+r.blockRange < end {
+			end = start + r.blockRange
+		}
+
+		filters.FromBlock = new(big.Int).SetUint64(start)
+		filters.ToBlock = new(big.Int).SetUint64(end)
+
+		logs, err := r.filterLogs(ctx, filters)
+		if err != nil {
+			return errors.Wrap(err, "failed to get filter logs")
+		}
+
+		for _, log := range logs {
+			pos := logPosition{block: log.BlockNumber, index: log.Index}
+			if _, ok := p.applied[pos]; ok {
+				continue
+			}
+
+			metrics.MissedLogs.Add(1)
+			r.log.WithFields(logan.F{
+				"block":     log.BlockNumber,
+				"log_index": log.Index,
+				"tx_hash":   log.TxHash.Hex(),
+			}).Warn("log was missed by subscription, applying it")
+
+			if err := r.applyEvent(ctx, log); err != nil {
+				return errors.Wrap(err, "failed to apply missed event")
+			}
+			p.applied[pos] = struct{}{}
+		}
+
+		p.polledBlock = end
+		for pos := range p.applied {
+			if pos.block <= end {
+				delete(p.applied, pos)
+			}
+		}
+	}
+
+	p.completedBlock = head
+	return nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/Swapica/indexer-svc/internal/gobind"
+	"github.com/Swapica/indexer-svc/internal/notify"
+	"github.com/Swapica/indexer-svc/internal/service/state"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// publish passes the applied change to all the listeners, the transaction is
+// fetched only when there are any
+func (r *indexer) publish(ctx context.Context, e notify.Event) error {
+	if len(r.listeners) == 0 {
+		return nil
+	}
+
+	e.Tx = r.txDetails(ctx, common.HexToHash(e.TxHash))
+	for _, l := range r.listeners {
+		if err := l.Notify(ctx, e); err != nil {
+			return errors.Wrap(err, "failed to notify listener", logan.F{
+				"event":  e.Type,
+				"cursor": e.Cursor,
+			})
+		}
+	}
+	return nil
+}
+
+func (r *indexer) newEvent(t notify.EventType, log *types.Log) notify.Event {
+	return notify.Event{
+		Cursor:   notify.Cursor(log.BlockNumber, log.Index),
+		Type:     t,
+		ChainID:  r.chainID,
+		Block:    log.BlockNumber,
+		TxHash:   log.TxHash.Hex(),
+		LogIndex: log.Index,
+	}
+}
+
+func (r *indexer) newOrderCreated(ctx context.Context, o gobind.ISwapicaOrder, useRelayer bool, log *types.Log) notify.Event {
+	e := r.newEvent(notify.OrderCreated, log)
+	e.OrderID = o.OrderId.Int64()
+	e.State = state.State(o.Status.State).String()
+	e.Creator = o.Creator.String()
+	e.TokenToSell = o.TokenToSell.String()
+	e.AmountToSell = o.AmountToSell.String()
+	e.TokenToBuy = o.TokenToBuy.String()
+	e.AmountToBuy = o.AmountToBuy.String()
+	e.DestinationChain = o.DestinationChain.Int64()
+	e.UseRelayer = &useRelayer
+	setOrderMatch(&e, o.Status)
+
+	// the amounts are already normalized when the order was stored
+	if stored, ok := r.storedOrder(e.OrderID); ok {
+		e.Normalized = stored.Normalized
+	} else {
+		e.Normalized = r.normalizeOrder(ctx, newStoreOrder(o, useRelayer))
+	}
+	return e
+}
+
+func (r *indexer) newOrderUpdated(id *big.Int, status gobind.ISwapicaOrderStatus, log *types.Log) notify.Event {
+	e := r.newEvent(notify.OrderUpdated, log)
+	e.OrderID = id.Int64()
+	e.State = state.State(status.State).String()
+	setOrderMatch(&e, status)
+
+	if o, ok := r.storedOrder(e.OrderID); ok {
+		e.Creator = o.Creator
+		e.TokenToSell, e.AmountToSell = o.TokenToSell, o.AmountToSell
+		e.TokenToBuy, e.AmountToBuy = o.TokenToBuy, o.AmountToBuy
+		e.DestinationChain = o.DestinationChain
+		e.UseRelayer = &o.UseRelayer
+		e.Normalized = o.Normalized
+	}
+	return e
+}
+
+func setOrderMatch(e *notify.Event, status gobind.ISwapicaOrderStatus) {
+	if status.MatchId != nil {
+		e.MatchID = status.MatchId.Int64()
+	}
+	if status.MatchSwapica != (common.Address{}) {
+		e.MatchSwapica = status.MatchSwapica.String()
+	}
+}
+
+func (r *indexer) newMatchCreated(ctx context.Context, m gobind.ISwapicaMatch, useRelayer bool, log *types.Log) notify.Event {
+	e := r.newEvent(notify.MatchCreated, log)
+	e.MatchID = m.MatchId.Int64()
+	e.State = state.State(m.State).String()
+	e.Creator = m.Creator.String()
+	e.TokenToSell = m.TokenToSell.String()
+	e.AmountToSell = m.AmountToSell.String()
+	e.OriginChain = m.OriginChainId.Int64()
+	e.OriginOrderID = m.OriginOrderId.Int64()
+	e.UseRelayer = &useRelayer
+
+	if stored, ok := r.storedMatch(e.MatchID); ok {
+		e.Normalized = stored.Normalized
+	} else {
+		e.Normalized = r.normalizeMatch(ctx, newStoreMatch(m, useRelayer))
+	}
+	return e
+}
+
+func (r *indexer) newMatchUpdated(id *big.Int, newState uint8, log *types.Log) notify.Event {
+	e := r.newEvent(notify.MatchUpdated, log)
+	e.MatchID = id.Int64()
+	e.State = state.State(newState).String()
+
+	if m, ok := r.storedMatch(e.MatchID); ok {
+		e.Creator = m.Creator
+		e.TokenToSell, e.AmountToSell = m.TokenToSell, m.AmountToSell
+		e.OriginChain, e.OriginOrderID = m.OriginChain, m.OriginOrderID
+		e.UseRelayer = &m.UseRelayer
+		e.Normalized = m.Normalized
+	}
+	return e
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/url"
+	"strconv"
+
+	"github.com/Swapica/indexer-svc/internal/archive"
+	"github.com/Swapica/indexer-svc/internal/config"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+type RebuildResult struct {
+	ChainID int64 `json:"chain_id"`
+	// Events is the number of the replayed archived events
+	Events    int    `json:"events"`
+	LastBlock uint64 `json:"last_block"`
+	// Checkpoint is true when the last block was written to the collector,
+	// which happens only when the collector had no block record
+	Checkpoint bool `json:"checkpoint"`
+}
+
+// ErrRebuildNotConfirmed is returned when the rebuild is not confirmed, it
+// deletes the chain data that can't be restored without the archive
+var ErrRebuildNotConfirmed = errors.New("rebuild deletes chain data and must be confirmed")
+
+// ErrArchiveIncomplete is returned when the archive misses the creations of
+// some orders or matches, the rebuild would lose them
+var ErrArchiveIncomplete = errors.New("event archive does not cover the chain from its start")
+
+// Rebuild removes the orders and matches of the chain from the collector and
+// the local store, then replays the archived events of the chain in the chain
+// order. The service must be stopped while the chain is rebuilt.
+func Rebuild(cfg config.Config, out io.Writer, chainID int64, confirmed bool) error {
+	if !confirmed {
+		return ErrRebuildNotConfirmed
+	}
+	if chainID != cfg.Network().ChainID {
+		return errors.From(errors.New("chain is not the configured one"), logan.F{
+			"chain":            chainID,
+			"network.chain_id": cfg.Network().ChainID,
+		})
+	}
+	if cfg.EventArchive() == nil {
+		return ErrArchiveDisabled
+	}
+
+	result, err := newService(cfg).rebuild(context.Background())
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(result), "failed to encode result")
+}
+
+func (s *service) rebuild(ctx context.Context) (*RebuildResult, error) {
+	r := newIndexer(s.cfg, 0)
+	// The origin orders of other chains may be missing until their chains are
+	// rebuilt too, so waiting for them would only stall the replay
+	r.originWaitTimeout = 0
+
+	records := r.archive.Records(r.chainID)
+	result := &RebuildResult{ChainID: r.chainID, Events: len(records)}
+
+	if err := s.checkArchiveCoverage(ctx, r, records); err != nil {
+		return nil, err
+	}
+	if err := r.resetChain(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to reset chain data")
+	}
+
+	for _, rec := range records {
+		if err := r.applyEvent(ctx, rec.Log); err != nil {
+			return nil, errors.Wrap(err, "failed to replay event", logan.F{
+				"block":     rec.Block,
+				"log_index": rec.LogIndex,
+			})
+		}
+		result.LastBlock = rec.Block
+	}
+
+	// The replay does not move the existing checkpoint, it only restores the
+	// lost one, so the service does not scan the chain from the start again
+	_, found, err := s.getCheckpoint(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get last block")
+	}
+	if !found && len(records) != 0 {
+		if err = r.updateLastBlock(ctx, result.LastBlock); err != nil {
+			return nil, errors.Wrap(err, "failed to update last block")
+		}
+		result.Checkpoint = true
+	}
+
+	s.log.WithFields(logan.F{
+		"events":     result.Events,
+		"last_block": result.LastBlock,
+	}).Info("chain rebuilt from the event archive")
+	return result, nil
+}
+
+// checkArchiveCoverage makes sure the archive has the creations of all the
+// orders and matches the contract had at the checkpoint, the IDs are assigned
+// sequentially from 1. The archive is written before the checkpoint, so the
+// events after the checkpoint are indexed when the service is started again.
+func (s *service) checkArchiveCoverage(ctx context.Context, r *indexer, records []archive.Record) error {
+	if len(records) == 0 {
+		return errors.From(ErrArchiveIncomplete, logan.F{"reason": "no archived events of the chain"})
+	}
+
+	block, found, err := s.getCheckpoint(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get last block")
+	}
+	if !found {
+		block = records[len(records)-1].Block
+	}
+
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(block)}
+	var orders, matches *big.Int
+	err = r.rpc(ctx, func(ctx context.Context) (err error) {
+		opts.Context = ctx
+		orders, err = r.swapica.GetAllOrdersLength(opts)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to get orders length", logan.F{"block": block})
+	}
+	err = r.rpc(ctx, func(ctx context.Context) (err error) {
+		opts.Context = ctx
+		matches, err = r.swapica.GetAllMatchesLength(opts)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to get matches length", logan.F{"block": block})
+	}
+
+	created := map[string]map[int64]bool{
+		archive.EntityOrder: make(map[int64]bool),
+		archive.EntityMatch: make(map[int64]bool),
+	}
+	for _, rec := range records {
+		if rec.Event == "OrderCreated" || rec.Event == "MatchCreated" {
+			created[rec.Entity][rec.ID] = true
+		}
+	}
+
+	for _, c := range []struct {
+		entity string
+		length int64
+	}{
+		{archive.EntityOrder, orders.Int64()},
+		{archive.EntityMatch, matches.Int64()},
+	} {
+		var missing, firstMissing int64
+		for id := int64(1); id <= c.length; id++ {
+			if !created[c.entity][id] {
+				if missing == 0 {
+					firstMissing = id
+				}
+				missing++
+			}
+		}
+		if missing != 0 {
+			return errors.From(ErrArchiveIncomplete, logan.F{
+				"entity":        c.entity,
+				"length":        c.length,
+				"missing":       missing,
+				"first_missing": firstMissing,
+				"block":         block,
+			})
+		}
+	}
+	return nil
+}
+
+// resetChain deletes the chain orders and matches from the collector and the
+// local store, the block record is kept. The collector must support deleting
+// the chain entities, nothing is replayed otherwise.
+func (r *indexer) resetChain(ctx context.Context) error {
+	for _, path := range []string{"/orders", "/match_orders"} {
+		u, _ := url.Parse(strconv.FormatInt(r.chainID, 10) + path)
+		if err := r.collector.Delete(ctx, u, nil); err != nil {
+			return errors.Wrap(err, "failed to delete chain entities from collector", logan.F{"path": u.String()})
+		}
+	}
+
+	if r.store == nil {
+		return nil
+	}
+	return errors.Wrap(r.store.Reset(), "failed to reset local store")
+}
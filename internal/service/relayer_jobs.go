@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Swapica/indexer-svc/internal/gobind"
+	"github.com/Swapica/indexer-svc/internal/notify"
+	"github.com/Swapica/indexer-svc/internal/relayer"
+	"github.com/Swapica/indexer-svc/internal/service/state"
+	"github.com/Swapica/order-aggregator-svc/resources"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// relayerJobs pushes the relayer jobs when a match is created and finishes
+// them when the executed entity of this chain is updated. The jobs of the
+// counterpart chain are finished by the indexer of that chain.
+type relayerJobs struct {
+	r         *indexer
+	queue     relayer.Queue
+	expiredAt time.Time
+}
+
+// relayerExpirePeriod is how often the pending jobs are checked against the
+// collector
+const relayerExpirePeriod = 5 * time.Minute
+
+func (j relayerJobs) Notify(ctx context.Context, e notify.Event) error {
+	switch e.Type {
+	case notify.MatchCreated:
+		return j.push(ctx, e)
+	case notify.OrderUpdated:
+		return j.finish(ctx, relayer.JobID(relayer.ExecuteOrder, e.ChainID, e.OrderID), e.State)
+	case notify.MatchUpdated:
+		return j.finish(ctx, relayer.JobID(relayer.ExecuteMatch, e.ChainID, e.MatchID), e.State)
+	}
+	return nil
+}
+
+// expireRelayerJobs finishes the pending execute_order jobs pushed by this
+// chain whose origin orders are final in the collector. They are finished by
+// the indexer of the origin chain only when it shares the queue, so they
+// would stay pending in the memory queue. It runs once in relayerExpirePeriod.
+func (r *indexer) expireRelayerJobs(ctx context.Context) error {
+	if r.jobs == nil || time.Since(r.jobs.expiredAt) < relayerExpirePeriod {
+		return nil
+	}
+	r.jobs.expiredAt = time.Now()
+
+	pending, err := r.jobs.queue.List(ctx, relayer.StatusPending)
+	if err != nil {
+		return errors.Wrap(err, "failed to list pending relayer jobs")
+	}
+	for _, job := range pending {
+		if job.Kind != relayer.ExecuteOrder || job.MatchChainID != r.chainID {
+			continue
+		}
+		order, err := r.getChainOrder(ctx, job.ChainID, job.OrderID)
+		if err != nil {
+			return errors.Wrap(err, "failed to get origin order", logan.F{"job": job.ID})
+		}
+		if order == nil || !state.State(order.Attributes.State).IsFinal() {
+			continue
+		}
+		if err = r.jobs.finish(ctx, job.ID, state.State(order.Attributes.State).String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushRelayerJobs pushes the jobs of the match that already exists, the jobs
+// already in the queue are left as they are
+func (r *indexer) pushRelayerJobs(ctx context.Context, m gobind.ISwapicaMatch, useRelayer bool, log *types.Log) error {
+	if r.jobs == nil {
+		return nil
+	}
+	return r.jobs.push(ctx, r.newMatchCreated(ctx, m, useRelayer, log))
+}
+
+// push creates the job executing the origin order when the match creator
+// asked for the relayer, and the job executing the match when the order
+// creator did
+func (j relayerJobs) push(ctx context.Context, e notify.Event) error {
+	now := time.Now().UTC()
+	log := j.r.log.WithFields(logan.F{
+		"match_id":        e.MatchID,
+		"origin_chain":    e.OriginChain,
+		"origin_order_id": e.OriginOrderID,
+	})
+
+	// Finish ignores the jobs it does not know, so the jobs of the entities
+	// executed or canceled before the push would stay pending forever
+	order, err := j.r.getChainOrder(ctx, e.OriginChain, e.OriginOrderID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get origin order")
+	}
+
+	if e.UseRelayer != nil && *e.UseRelayer {
+		if err = j.pushExecuteOrder(ctx, log, e, order, now); err != nil {
+			return err
+		}
+	}
+
+	if order == nil {
+		log.Warn("origin order is not indexed, execute match job is not pushed")
+		return nil
+	}
+	if !order.Attributes.UseRelayer {
+		return nil
+	}
+
+	match, err := j.r.getMatch(ctx, e.MatchID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get match")
+	}
+	if match != nil && state.State(match.Attributes.State).IsFinal() {
+		log.WithField("state", state.State(match.Attributes.State).String()).
+			Info("match is already final, execute match job is not pushed")
+		return nil
+	}
+
+	err = j.queue.Push(ctx, relayer.Job{
+		ID:           relayer.JobID(relayer.ExecuteMatch, e.ChainID, e.MatchID),
+		Kind:         relayer.ExecuteMatch,
+		ChainID:      e.ChainID,
+		Swapica:      j.r.contractAddress.String(),
+		OrderID:      e.OriginOrderID,
+		MatchID:      e.MatchID,
+		Receiver:     order.Attributes.Creator,
+		MatchChainID: e.ChainID,
+		Status:       relayer.StatusPending,
+		Cursor:       e.Cursor,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to push execute match job")
+	}
+	log.Info("execute match job pushed")
+	return nil
+}
+
+// pushExecuteOrder pushes the job unless the origin order is final, the order
+// not indexed yet gets the job anyway
+func (j relayerJobs) pushExecuteOrder(ctx context.Context, log *logan.Entry, e notify.Event, order *resources.Order, now time.Time) error {
+	if order != nil && state.State(order.Attributes.State).IsFinal() {
+		log.WithField("state", state.State(order.Attributes.State).String()).
+			Info("origin order is already final, execute order job is not pushed")
+		return nil
+	}
+
+	origin, err := j.r.getChain(ctx, e.OriginChain)
+	if err != nil {
+		return errors.Wrap(err, "failed to get origin chain")
+	}
+	err = j.queue.Push(ctx, relayer.Job{
+		ID:           relayer.JobID(relayer.ExecuteOrder, e.OriginChain, e.OriginOrderID),
+		Kind:         relayer.ExecuteOrder,
+		ChainID:      e.OriginChain,
+		Swapica:      origin.Attributes.SwapContract,
+		OrderID:      e.OriginOrderID,
+		MatchID:      e.MatchID,
+		Receiver:     e.Creator,
+		MatchSwapica: j.r.contractAddress.String(),
+		MatchChainID: e.ChainID,
+		Status:       relayer.StatusPending,
+		Cursor:       e.Cursor,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to push execute order job")
+	}
+	log.Info("execute order job pushed")
+	return nil
+}
+
+func (j relayerJobs) finish(ctx context.Context, id, newState string) error {
+	var status relayer.Status
+	switch newState {
+	case state.Executed.String():
+		status = relayer.StatusDone
+	case state.Canceled.String():
+		status = relayer.StatusCanceled
+	default:
+		return nil
+	}
+
+	if err := j.queue.Finish(ctx, id, status); err != nil {
+		return errors.Wrap(err, "failed to finish relayer job", logan.F{"job": id})
+	}
+	return nil
+}
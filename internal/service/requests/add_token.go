@@ -0,0 +1,20 @@
+package requests
+
+import (
+	"github.com/Swapica/order-aggregator-svc/resources"
+)
+
+type AddTokenRequest struct {
+	Data resources.Token `json:"data"`
+}
+
+func NewAddToken(attrs resources.TokenAttributes) AddTokenRequest {
+	return AddTokenRequest{
+		Data: resources.Token{
+			Key: resources.Key{
+				Type: resources.TOKEN,
+			},
+			Attributes: attrs,
+		},
+	}
+}
@@ -10,16 +10,7 @@ import (
 const ethAddress0 = "0x0000000000000000000000000000000000000000"
 
 func NewUpdateOrder(id *big.Int, status gobind.ISwapicaOrderStatus) resources.UpdateOrderRequest {
-	var matchSwapica *string
-	if str := status.MatchSwapica.String(); str != ethAddress0 {
-		matchSwapica = &str
-	}
-
-	var matchId *int64
-	if mid := status.MatchId; mid != nil && mid.Int64() != 0 {
-		i := mid.Int64()
-		matchId = &i
-	}
+	matchId, matchSwapica := OrderMatch(status)
 
 	return resources.UpdateOrderRequest{
 		Data: resources.UpdateOrder{
@@ -35,3 +26,17 @@ func NewUpdateOrder(id *big.Int, status gobind.ISwapicaOrderStatus) resources.Up
 		},
 	}
 }
+
+// OrderMatch returns nil values when the order was not matched yet
+func OrderMatch(status gobind.ISwapicaOrderStatus) (matchId *int64, matchSwapica *string) {
+	if str := status.MatchSwapica.String(); str != ethAddress0 {
+		matchSwapica = &str
+	}
+
+	if mid := status.MatchId; mid != nil && mid.Int64() != 0 {
+		i := mid.Int64()
+		matchId = &i
+	}
+
+	return matchId, matchSwapica
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+
+	"github.com/Swapica/indexer-svc/internal/calldata"
+	"github.com/Swapica/indexer-svc/internal/config"
+	"github.com/Swapica/indexer-svc/internal/gobind"
+	"github.com/Swapica/indexer-svc/internal/service/state"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+const (
+	EntityOrder = "order"
+	EntityMatch = "match"
+)
+
+const (
+	ResyncAdded     = "added"
+	ResyncUpdated   = "updated"
+	ResyncUnchanged = "unchanged"
+)
+
+var ErrUnknownEntity = errors.New("unknown entity")
+
+// ErrCreationNotFound is returned when the entity missing in the collector
+// can't be added, because its use_relayer flag is known only from the
+// creation event and the event is before the scanned blocks
+var ErrCreationNotFound = errors.New("creation event not found, use earlier from_block")
+
+// HistoryEntry is an update event of the order or match
+type HistoryEntry struct {
+	Event    string `json:"event"`
+	Block    uint64 `json:"block"`
+	TxHash   string `json:"tx_hash"`
+	LogIndex uint   `json:"log_index"`
+	State    string `json:"state"`
+	// Tx is nil when the transaction could not be fetched
+	Tx *calldata.Tx `json:"tx,omitempty"`
+}
+
+type ResyncResult struct {
+	Entity string `json:"entity"`
+	ID     int64  `json:"id"`
+	// State is the state in the contract
+	State string `json:"state"`
+	// CollectorState is the state in the collector before resync
+	CollectorState *string        `json:"collector_state"`
+	History        []HistoryEntry `json:"history"`
+	Action         string         `json:"action"`
+}
+
+// Resync rewrites the collector record of a single order or match with the
+// contract state and writes the result with the update history to out
+func Resync(cfg config.Config, out io.Writer, entity string, id int64, fromBlock uint64) error {
+	result, err := newIndexer(cfg, 0).resync(context.Background(), entity, id, fromBlock)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(result), "failed to encode result")
+}
+
+func (r *indexer) resync(ctx context.Context, entity string, id int64, fromBlock uint64) (*ResyncResult, error) {
+	switch entity {
+	case EntityOrder:
+		result, err := r.resyncOrder(ctx, id, fromBlock)
+		return result, errors.Wrap(err, "failed to resync order", logan.F{"order_id": id})
+	case EntityMatch:
+		result, err := r.resyncMatch(ctx, id, fromBlock)
+		return result, errors.Wrap(err, "failed to resync match", logan.F{"match_id": id})
+	default:
+		return nil, errors.From(ErrUnknownEntity, logan.F{"entity": entity})
+	}
+}
+
+func (r *indexer) resyncOrder(ctx context.Context, id int64, fromBlock uint64) (*ResyncResult, error) {
+	o, err := r.getContractOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := r.entityHistory(ctx, "OrderUpdated", id, fromBlock)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get order history")
+	}
+
+	result := ResyncResult{
+		Entity:  EntityOrder,
+		ID:      id,
+		State:   state.State(o.Status.State).String(),
+		History: history,
+		Action:  ResyncUnchanged,
+	}
+
+	collected, err := r.getOrder(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get order from collector")
+	}
+	if collected == nil {
+		flags, err := r.scanRelayerFlags(ctx, fromBlock)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan relayer flags")
+		}
+		useRelayer, known := flags.order(id)
+		if !known {
+			return nil, errors.From(ErrCreationNotFound, logan.F{"from_block": fromBlock})
+		}
+		if _, err = r.addOrder(ctx, *o, useRelayer); err != nil {
+			return nil, errors.Wrap(err, "failed to add order")
+		}
+		result.Action = ResyncAdded
+
+		log := flags.logs[entityKey{entity: EntityOrder, id: id}]
+		return &result, r.publish(ctx, r.newOrderCreated(ctx, *o, useRelayer, &log))
+	}
+
+	collectorState := state.State(collected.Attributes.State).String()
+	result.CollectorState = &collectorState
+	if diffs := r.compareOrder(ctx, false, *o, collected.Attributes, nil); len(diffs) != 0 {
+		if err = r.patchOrder(ctx, o.OrderId, o.Status); err != nil {
+			return nil, errors.Wrap(err, "failed to update order")
+		}
+		result.Action = ResyncUpdated
+
+		if log, ok := r.lastUpdateLog(history); ok {
+			return &result, r.publish(ctx, r.newOrderUpdated(o.OrderId, o.Status, &log))
+		}
+	}
+
+	return &result, nil
+}
+
+func (r *indexer) resyncMatch(ctx context.Context, id int64, fromBlock uint64) (*ResyncResult, error) {
+	m, err := r.getContractMatch(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := r.entityHistory(ctx, "MatchUpdated", id, fromBlock)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get match history")
+	}
+
+	result := ResyncResult{
+		Entity:  EntityMatch,
+		ID:      id,
+		State:   state.State(m.State).String(),
+		History: history,
+		Action:  ResyncUnchanged,
+	}
+
+	collected, err := r.getMatch(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get match from collector")
+	}
+	if collected == nil {
+		flags, err := r.scanRelayerFlags(ctx, fromBlock)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan relayer flags")
+		}
+		useRelayer, known := flags.match(id)
+		if !known {
+			return nil, errors.From(ErrCreationNotFound, logan.F{"from_block": fromBlock})
+		}
+		if _, err = r.addMatch(ctx, *m, useRelayer); err != nil {
+			return nil, errors.Wrap(err, "failed to add match")
+		}
+		result.Action = ResyncAdded
+
+		log := flags.logs[entityKey{entity: EntityMatch, id: id}]
+		return &result, r.publish(ctx, r.newMatchCreated(ctx, *m, useRelayer, &log))
+	}
+
+	collectorState := state.State(collected.Attributes.State).String()
+	result.CollectorState = &collectorState
+	if m.State != collected.Attributes.State {
+		if err = r.patchMatch(ctx, m.MatchId, m.State); err != nil {
+			return nil, errors.Wrap(err, "failed to update match")
+		}
+		result.Action = ResyncUpdated
+
+		if log, ok := r.lastUpdateLog(history); ok {
+			return &result, r.publish(ctx, r.newMatchUpdated(m.MatchId, m.State, &log))
+		}
+	}
+
+	return &result, nil
+}
+
+// lastUpdateLog points the resync update to the last update event, the update
+// is not published without it, because the events are ordered by their logs
+func (r *indexer) lastUpdateLog(history []HistoryEntry) (types.Log, bool) {
+	if len(history) == 0 {
+		r.log.Warn("no update events after from_block, resync update is not published")
+		return types.Log{}, false
+	}
+	last := history[len(history)-1]
+	return types.Log{
+		BlockNumber: last.Block,
+		TxHash:      common.HexToHash(last.TxHash),
+		Index:       last.LogIndex,
+	}, true
+}
+
+func (r *indexer) getContractOrder(ctx context.Context, id int64) (*gobind.ISwapicaOrder, error) {
+	return r.contractOrder(ctx, r.swapica, id)
+}
+
+// contractOrder relies on the contract assigning order IDs sequentially from 1
+func (r *indexer) contractOrder(ctx context.Context, swapica *gobind.Swapica, id int64) (*gobind.ISwapicaOrder, error) {
+	if id <= 0 {
+		return nil, errors.From(errors.New("order not found in contract"), logan.F{"order_id": id})
+	}
+	var orders []gobind.ISwapicaOrder
+	err := r.rpc(ctx, func(ctx context.Context) (err error) {
+		orders, err = swapica.GetAllOrders(&bind.CallOpts{Context: ctx}, big.NewInt(id-1), big.NewInt(1))
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get order from contract")
+	}
+	if len(orders) == 0 || orders[0].OrderId.Int64() != id {
+		return nil, errors.From(errors.New("order not found in contract"), logan.F{"order_id": id})
+	}
+	return &orders[0], nil
+}
+
+// getContractMatch relies on the contract assigning match IDs sequentially from 1
+func (r *indexer) getContractMatch(ctx context.Context, id int64) (*gobind.ISwapicaMatch, error) {
+	if id <= 0 {
+		return nil, errors.From(errors.New("match not found in contract"), logan.F{"match_id": id})
+	}
+	var matches []gobind.ISwapicaMatch
+	err := r.rpc(ctx, func(ctx context.Context) (err error) {
+		matches, err = r.swapica.GetAllMatches(&bind.CallOpts{Context: ctx}, big.NewInt(id-1), big.NewInt(1))
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get match from contract")
+	}
+	if len(matches) == 0 || matches[0].MatchId.Int64() != id {
+		return nil, errors.From(errors.New("match not found in contract"), logan.F{"match_id": id})
+	}
+	return &matches[0], nil
+}
+
+// entityHistory filters update events by the indexed ID, creation events
+// have no indexed fields, so they can't be found this way
+func (r *indexer) entityHistory(ctx context.Context, eventName string, id int64, fromBlock uint64) ([]HistoryEntry, error) {
+	head, err := r.blockNumber(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get last block number")
+	}
+
+	query := r.filters()
+	query.Topics = [][]common.Hash{
+		{r.swapicaAbi.Events[eventName].ID},
+		{common.BigToHash(big.NewInt(id))},
+	}
+
+	history := make([]HistoryEntry, 0)
+	err = r.forEachLog(ctx, query, fromBlock, head, func(log types.Log) error {
+		var s uint8
+		switch eventName {
+		case "OrderUpdated":
+			var e gobind.SwapicaOrderUpdated
+			if err := r.swapicaAbi.UnpackIntoInterface(&e, eventName, log.Data); err != nil {
+				return errors.Wrap(err, "failed to unpack event", logan.F{"event": eventName})
+			}
+			s = e.Status.State
+		case "MatchUpdated":
+			var e gobind.SwapicaMatchUpdated
+			if err := r.swapicaAbi.UnpackIntoInterface(&e, eventName, log.Data); err != nil {
+				return errors.Wrap(err, "failed to unpack event", logan.F{"event": eventName})
+			}
+			s = e.Status
+		}
+
+		history = append(history, HistoryEntry{
+			Event:    eventName,
+			Block:    log.BlockNumber,
+			TxHash:   log.TxHash.Hex(),
+			LogIndex: log.Index,
+			State:    state.State(s).String(),
+			Tx:       r.txDetails(ctx, log.TxHash),
+		})
+		return nil
+	})
+
+	return history, err
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/Swapica/indexer-svc/internal/retry"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// limitExceededCode is returned by the providers when the request rate is over
+const limitExceededCode = -32005
+
+// transientRPC reports whether the RPC call may succeed when repeated: the
+// provider failed with 5xx or 429, limited the rate, or was not reached in
+// time. The JSON-RPC errors, e.g. reverts, are permanent.
+func transientRPC(err error) bool {
+	switch e := errors.Cause(err).(type) {
+	case rpc.HTTPError:
+		return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+	case rpc.Error:
+		return e.ErrorCode() == limitExceededCode
+	case net.Error:
+		return true
+	}
+	err = errors.Cause(err)
+	return err == context.DeadlineExceeded || err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// rpc calls fn with the request_timeout deadline and repeats it on the
+// transient errors within the request_attempts budget
+func (r *indexer) rpc(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.rpcBudget.Do(ctx, transientRPC, fn)
+}
+
+func (r *indexer) blockNumber(ctx context.Context) (uint64, error) {
+	return blockNumber(ctx, r.ethClient, r.rpcBudget)
+}
+
+func (r *indexer) filterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	err := r.rpc(ctx, func(ctx context.Context) (err error) {
+		logs, err = r.ethClient.FilterLogs(ctx, q)
+		return err
+	})
+	return logs, err
+}
+
+// blockNumber is used by the service commands running without an indexer
+func blockNumber(ctx context.Context, cli *ethclient.Client, budget retry.Budget) (uint64, error) {
+	var head uint64
+	err := budget.Do(ctx, transientRPC, func(ctx context.Context) (err error) {
+		head, err = cli.BlockNumber(ctx)
+		return err
+	})
+	return head, err
+}
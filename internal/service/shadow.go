@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/Swapica/indexer-svc/internal/archive"
+	"github.com/Swapica/indexer-svc/internal/config"
+	"github.com/Swapica/indexer-svc/internal/sink"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+type ShadowOpts struct {
+	// Expected is the write record of the production indexer, see sink.record
+	Expected string
+	// Output is the file the shadow writes are recorded to
+	Output string
+	// FromBlock is used without the event archive, the start block of the
+	// service by default
+	FromBlock *uint64
+	// ToBlock is the last block of the expected writes by default
+	ToBlock *uint64
+}
+
+type ShadowResult struct {
+	ChainID        int64             `json:"chain_id"`
+	FromBlock      uint64            `json:"from_block"`
+	ToBlock        uint64            `json:"to_block"`
+	ExpectedWrites int               `json:"expected_writes"`
+	ActualWrites   int               `json:"actual_writes"`
+	Divergences    []sink.Divergence `json:"divergences"`
+}
+
+// Shadow processes the events of the chain by the handlers of this build
+// without writing to the collector and compares the writes with the recorded
+// writes of the production indexer. The events are replayed from the archive
+// when it is enabled, otherwise they are read from the chain. Entities created
+// before the first processed block are unknown to the shadow, so their updates
+// diverge.
+//
+// Reports whether no divergences were found.
+func Shadow(cfg config.Config, out io.Writer, opts ShadowOpts) (bool, error) {
+	f, err := os.Open(opts.Expected)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to open expected writes")
+	}
+	expected, err := sink.ReadWrites(f)
+	_ = f.Close()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to read expected writes")
+	}
+
+	result, err := newService(cfg).shadow(context.Background(), expected, opts)
+	if err != nil {
+		return false, err
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(result); err != nil {
+		return false, errors.Wrap(err, "failed to encode result")
+	}
+	return len(result.Divergences) == 0, nil
+}
+
+func (s *service) shadow(ctx context.Context, expected []sink.Write, opts ShadowOpts) (*ShadowResult, error) {
+	result := &ShadowResult{ChainID: s.cfg.Network().ChainID, ExpectedWrites: len(expected)}
+	for _, w := range expected {
+		if w.Block > result.ToBlock {
+			result.ToBlock = w.Block
+		}
+	}
+	if opts.ToBlock != nil {
+		result.ToBlock = *opts.ToBlock
+	}
+
+	writes, err := sink.CreateLog(opts.Output)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create shadow write record")
+	}
+
+	r := newIndexer(s.cfg, 0)
+	r.collector = sink.NewShadow(r.collector, writes, sink.ShadowOpts{ChainID: r.chainID})
+	// The shadow must not touch anything the production indexer writes to
+	records := r.archive
+	r.archive, r.store = nil, nil
+	// The held matches are released by the indexing loops, which the shadow
+	// does not run, so the matches are added right away
+	r.originWaitTimeout = 0
+
+	if records != nil {
+		archived := records.Records(r.chainID)
+		if len(archived) != 0 {
+			result.FromBlock = archived[0].Block
+		}
+		err = r.shadowArchive(ctx, archived, result.ToBlock)
+	} else {
+		result.FromBlock, err = s.shadowFromBlock(ctx, opts)
+		if err == nil {
+			err = r.forEachLog(ctx, r.filters(), result.FromBlock, result.ToBlock, func(log types.Log) error {
+				return r.handleEvent(ctx, log)
+			})
+		}
+	}
+	if cerr := writes.Close(); err == nil {
+		err = errors.Wrap(cerr, "failed to close shadow write record")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to process events")
+	}
+
+	f, err := os.Open(opts.Output)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open shadow write record")
+	}
+	defer f.Close()
+	actual, err := sink.ReadWrites(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read shadow write record")
+	}
+
+	result.ActualWrites = len(actual)
+	result.Divergences = sink.Diff(expected, actual)
+	s.log.WithFields(logan.F{
+		"expected_writes": result.ExpectedWrites,
+		"actual_writes":   result.ActualWrites,
+		"divergences":     len(result.Divergences),
+	}).Info("shadow run finished")
+	return result, nil
+}
+
+func (r *indexer) shadowArchive(ctx context.Context, records []archive.Record, toBlock uint64) error {
+	for _, rec := range records {
+		if rec.Block > toBlock {
+			return nil
+		}
+		if err := r.handleEvent(ctx, rec.Log); err != nil {
+			return errors.Wrap(err, "failed to handle archived event", logan.F{
+				"block":     rec.Block,
+				"log_index": rec.LogIndex,
+			})
+		}
+	}
+	return nil
+}
+
+func (s *service) shadowFromBlock(ctx context.Context, opts ShadowOpts) (uint64, error) {
+	if opts.FromBlock != nil {
+		return *opts.FromBlock, nil
+	}
+	n, err := s.getStartBlock(ctx)
+	return n, errors.Wrap(err, "failed to get start block")
+}
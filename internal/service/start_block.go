@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/Swapica/indexer-svc/internal/retry"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// findDeploymentBlock finds the first block where the contract has code with
+// binary search, so the provider must serve the historical state (archive node)
+func findDeploymentBlock(ctx context.Context, cli *ethclient.Client, budget retry.Budget, contract common.Address) (uint64, error) {
+	head, err := blockNumber(ctx, cli, budget)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get last block number")
+	}
+
+	var searchErr error
+	n := sort.Search(int(head)+1, func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		var code []byte
+		err := budget.Do(ctx, transientRPC, func(ctx context.Context) (err error) {
+			code, err = cli.CodeAt(ctx, contract, big.NewInt(int64(i)))
+			return err
+		})
+		if err != nil {
+			searchErr = errors.Wrap(err, "failed to get contract code, archive node is required", logan.F{
+				"block": i,
+			})
+			return true
+		}
+		return len(code) != 0
+	})
+	if searchErr != nil {
+		return 0, searchErr
+	}
+	if uint64(n) > head {
+		return 0, errors.From(errors.New("contract has no code at the last block"), logan.F{
+			"contract": contract.Hex(),
+		})
+	}
+
+	return uint64(n), nil
+}
+
+// findBlockByTime finds the first block with timestamp not less than t
+func findBlockByTime(ctx context.Context, cli *ethclient.Client, budget retry.Budget, t time.Time) (uint64, error) {
+	head, err := blockNumber(ctx, cli, budget)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get last block number")
+	}
+
+	var searchErr error
+	n := sort.Search(int(head)+1, func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		var header *types.Header
+		err := budget.Do(ctx, transientRPC, func(ctx context.Context) (err error) {
+			header, err = cli.HeaderByNumber(ctx, big.NewInt(int64(i)))
+			return err
+		})
+		if err != nil {
+			searchErr = errors.Wrap(err, "failed to get block header", logan.F{"block": i})
+			return true
+		}
+		return header.Time >= uint64(t.Unix())
+	})
+	if searchErr != nil {
+		return 0, searchErr
+	}
+	if uint64(n) > head {
+		return 0, errors.From(errors.New("start_time is later than the last block"), logan.F{
+			"start_time": t.Format(time.RFC3339),
+		})
+	}
+
+	return uint64(n), nil
+}
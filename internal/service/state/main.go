@@ -0,0 +1,78 @@
+package state
+
+import "strconv"
+
+// State mirrors ISwapica.State enum of the Swapica contract
+type State uint8
+
+const (
+	None State = iota
+	AwaitingMatch
+	AwaitingFinalization
+	Canceled
+	Executed
+)
+
+var names = map[State]string{
+	None:                 "NONE",
+	AwaitingMatch:        "AWAITING_MATCH",
+	AwaitingFinalization: "AWAITING_FINALIZATION",
+	Canceled:             "CANCELED",
+	Executed:             "EXECUTED",
+}
+
+func (s State) String() string {
+	if name, ok := names[s]; ok {
+		return name
+	}
+	return "UNKNOWN(" + strconv.Itoa(int(s)) + ")"
+}
+
+func (s State) IsValid() bool {
+	_, ok := names[s]
+	return ok
+}
+
+func (s State) IsFinal() bool {
+	return s == Canceled || s == Executed
+}
+
+// orderTransitions lists the states an order can move to from the given one.
+// An order is created awaiting match, then it is either canceled by the
+// creator or executed after the match on another chain was created.
+var orderTransitions = map[State][]State{
+	None:          {AwaitingMatch},
+	AwaitingMatch: {Canceled, Executed},
+}
+
+// matchTransitions lists the states a match can move to from the given one.
+// A match is created awaiting finalization, then it is either executed or
+// canceled after the origin order was canceled or executed by another match.
+var matchTransitions = map[State][]State{
+	None:                 {AwaitingFinalization},
+	AwaitingFinalization: {Canceled, Executed},
+}
+
+// CanOrderMove reports whether an order can move from one state to another.
+// Repeated updates with the same state are allowed, because the same event
+// may be processed more than once.
+func CanOrderMove(from, to State) bool {
+	return canMove(orderTransitions, from, to)
+}
+
+// CanMatchMove is the same as CanOrderMove, but for matches
+func CanMatchMove(from, to State) bool {
+	return canMove(matchTransitions, from, to)
+}
+
+func canMove(transitions map[State][]State, from, to State) bool {
+	if from == to {
+		return true
+	}
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
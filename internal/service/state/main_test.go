@@ -0,0 +1,49 @@
+package state
+
+import "testing"
+
+func TestCanOrderMove(t *testing.T) {
+	cases := []struct {
+		from, to State
+		want     bool
+	}{
+		{None, AwaitingMatch, true},
+		{AwaitingMatch, Canceled, true},
+		{AwaitingMatch, Executed, true},
+		{AwaitingMatch, AwaitingMatch, true},
+		{Executed, Executed, true},
+		{None, Executed, false},
+		{None, AwaitingFinalization, false},
+		{AwaitingMatch, AwaitingFinalization, false},
+		{Canceled, Executed, false},
+		{Executed, Canceled, false},
+		{Executed, AwaitingMatch, false},
+	}
+	for _, c := range cases {
+		if got := CanOrderMove(c.from, c.to); got != c.want {
+			t.Errorf("CanOrderMove(%s, %s) = %v, want %v", c.from, c.to, got, c.want)
+		}
+	}
+}
+
+func TestCanMatchMove(t *testing.T) {
+	cases := []struct {
+		from, to State
+		want     bool
+	}{
+		{None, AwaitingFinalization, true},
+		{AwaitingFinalization, Canceled, true},
+		{AwaitingFinalization, Executed, true},
+		{Canceled, Canceled, true},
+		{None, AwaitingMatch, false},
+		{None, Executed, false},
+		{AwaitingFinalization, AwaitingMatch, false},
+		{Executed, Canceled, false},
+		{Canceled, AwaitingFinalization, false},
+	}
+	for _, c := range cases {
+		if got := CanMatchMove(c.from, c.to); got != c.want {
+			t.Errorf("CanMatchMove(%s, %s) = %v, want %v", c.from, c.to, got, c.want)
+		}
+	}
+}
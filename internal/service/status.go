@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/Swapica/indexer-svc/internal/config"
+	"github.com/Swapica/order-aggregator-svc/resources"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// catchUpSampleBlocks limits the blocks fetched to estimate the catch-up time
+const catchUpSampleBlocks = 1000
+
+// collectorRequestsPerEvent is the usual number of the collector requests made
+// for an event: the existence check, the write and the checkpoint
+const collectorRequestsPerEvent = 3
+
+type Status struct {
+	ChainID          int64   `json:"chain_id"`
+	Head             uint64  `json:"head"`
+	Checkpoint       *uint64 `json:"checkpoint"`
+	Lag              uint64  `json:"lag"`
+	CatchUpEstimate  string  `json:"catch_up_estimate"`
+	ContractOrders   int64   `json:"contract_orders"`
+	ContractMatches  int64   `json:"contract_matches"`
+	CollectorOrders  int64   `json:"collector_orders"`
+	CollectorMatches int64   `json:"collector_matches"`
+	// Mismatches describes the differences between the chain and the collector
+	Mismatches []string `json:"mismatches"`
+}
+
+// PrintStatus collects the indexing status of the configured chain and
+// writes it to out in a human-readable form or in JSON
+func PrintStatus(cfg config.Config, out io.Writer, asJSON bool) error {
+	status, err := newService(cfg).getStatus(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "failed to get status")
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(status), "failed to encode status")
+	}
+
+	checkpoint := "none"
+	if status.Checkpoint != nil {
+		checkpoint = strconv.FormatUint(*status.Checkpoint, 10)
+	}
+	fmt.Fprintf(out, "chain:              %d\n", status.ChainID)
+	fmt.Fprintf(out, "head:               %d\n", status.Head)
+	fmt.Fprintf(out, "checkpoint:         %s\n", checkpoint)
+	fmt.Fprintf(out, "lag:                %d blocks\n", status.Lag)
+	fmt.Fprintf(out, "catch-up estimate:  %s\n", status.CatchUpEstimate)
+	fmt.Fprintf(out, "orders:             contract %d, collector %d\n", status.ContractOrders, status.CollectorOrders)
+	fmt.Fprintf(out, "matches:            contract %d, collector %d\n", status.ContractMatches, status.CollectorMatches)
+	if len(status.Mismatches) == 0 {
+		fmt.Fprintln(out, "status:             OK")
+		return nil
+	}
+	fmt.Fprintln(out, "mismatches:")
+	for _, m := range status.Mismatches {
+		fmt.Fprintf(out, "  - %s\n", m)
+	}
+	return nil
+}
+
+func (s *service) getStatus(ctx context.Context) (*Status, error) {
+	network := s.cfg.Network()
+	status := Status{ChainID: network.ChainID, Mismatches: []string{}}
+
+	head, err := blockNumber(ctx, network.EthClient, network.Retry)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get last block number")
+	}
+	status.Head = head
+
+	// the checkpoint request is timed as the collector round trip
+	start := time.Now()
+	checkpoint, found, err := s.getCheckpoint(ctx)
+	collectorRTT := time.Since(start)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get checkpoint")
+	}
+	if found {
+		status.Checkpoint = &checkpoint
+		if head > checkpoint {
+			status.Lag = head - checkpoint
+		}
+	} else {
+		status.Lag = head
+		status.Mismatches = append(status.Mismatches, "no checkpoint in collector")
+	}
+
+	estimate, err := s.estimateCatchUp(ctx, checkpoint, status.Lag, collectorRTT)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to estimate catch-up time")
+	}
+	status.CatchUpEstimate = estimate.String()
+
+	var orders, matches *big.Int
+	err = network.Retry.Do(ctx, transientRPC, func(ctx context.Context) (err error) {
+		orders, err = network.GetAllOrdersLength(&bind.CallOpts{Context: ctx})
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get orders length from contract")
+	}
+	err = network.Retry.Do(ctx, transientRPC, func(ctx context.Context) (err error) {
+		matches, err = network.GetAllMatchesLength(&bind.CallOpts{Context: ctx})
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get matches length from contract")
+	}
+	status.ContractOrders, status.ContractMatches = orders.Int64(), matches.Int64()
+
+	collectedOrders, err := listCollected[resources.Key](ctx, s.cfg.Collector(), network.ChainID, "/orders")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list orders in collector")
+	}
+	collectedMatches, err := listCollected[resources.Key](ctx, s.cfg.Collector(), network.ChainID, "/match_orders")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list matches in collector")
+	}
+	status.CollectorOrders, status.CollectorMatches = int64(len(collectedOrders)), int64(len(collectedMatches))
+
+	if status.ContractOrders != status.CollectorOrders {
+		status.Mismatches = append(status.Mismatches, fmt.Sprintf("orders count: contract %d, collector %d",
+			status.ContractOrders, status.CollectorOrders))
+	}
+	if status.ContractMatches != status.CollectorMatches {
+		status.Mismatches = append(status.Mismatches, fmt.Sprintf("matches count: contract %d, collector %d",
+			status.ContractMatches, status.CollectorMatches))
+	}
+
+	return &status, nil
+}
+
+// estimateCatchUp extrapolates the time of eth_getLogs calls over a sample
+// window of at most catchUpSampleBlocks after from, and adds the collector
+// requests made for each log found in the sample
+func (s *service) estimateCatchUp(ctx context.Context, from, lag uint64, collectorRTT time.Duration) (time.Duration, error) {
+	if lag == 0 {
+		return 0, nil
+	}
+
+	network := s.cfg.Network()
+	step := network.BlockRange + 1
+	if network.BlockRange == 0 || step > lag {
+		step = lag
+	}
+	sample := step
+	if sample > catchUpSampleBlocks {
+		sample = catchUpSampleBlocks
+	}
+
+	// Besides the indexed events the contract emits only the rare admin ones,
+	// so the logs are not filtered by topics
+	query := ethereum.FilterQuery{
+		Addresses: []common.Address{network.ContractAddress},
+		FromBlock: new(big.Int).SetUint64(from + 1),
+		ToBlock:   new(big.Int).SetUint64(from + sample),
+	}
+
+	var logs []types.Log
+	start := time.Now()
+	err := network.Retry.Do(ctx, transientRPC, func(ctx context.Context) (err error) {
+		logs, err = network.EthClient.FilterLogs(ctx, query)
+		return err
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get filter logs")
+	}
+	fetch := time.Since(start)
+
+	// The sample equals the step unless the step is longer, then the
+	// longer calls are extrapolated by the blocks
+	windows := (lag + sample - 1) / sample
+	events := uint64(len(logs)) * lag / sample
+
+	return fetch*time.Duration(windows) + collectorRTT*collectorRequestsPerEvent*time.Duration(events), nil
+}
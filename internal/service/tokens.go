@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Swapica/indexer-svc/internal/erc20"
+	"github.com/Swapica/indexer-svc/internal/service/requests"
+	"github.com/Swapica/order-aggregator-svc/resources"
+	"github.com/ethereum/go-ethereum/common"
+	"gitlab.com/distributed_lab/json-api-connector/cerrors"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+type tokenID struct {
+	chainID int64
+	address common.Address
+}
+
+// unknownTokenTTL is the time the tokens not found are not looked up again
+const unknownTokenTTL = 5 * time.Minute
+
+// tokenCache keeps the metadata of the tokens already registered in the
+// collector, so the token contracts are called only once per token. The
+// tokens not found are kept until the time they may be looked up again.
+type tokenCache struct {
+	mu      sync.RWMutex
+	tokens  map[tokenID]resources.TokenAttributes
+	unknown map[tokenID]time.Time
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{
+		tokens:  make(map[tokenID]resources.TokenAttributes),
+		unknown: make(map[tokenID]time.Time),
+	}
+}
+
+func (c *tokenCache) get(chainID int64, address common.Address) (resources.TokenAttributes, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t, ok := c.tokens[tokenID{chainID, address}]
+	return t, ok
+}
+
+func (c *tokenCache) put(chainID int64, address common.Address, t resources.TokenAttributes) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[tokenID{chainID, address}] = t
+	delete(c.unknown, tokenID{chainID, address})
+}
+
+func (c *tokenCache) isUnknown(chainID int64, address common.Address) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	until, ok := c.unknown[tokenID{chainID, address}]
+	return ok && time.Now().Before(until)
+}
+
+func (c *tokenCache) putUnknown(chainID int64, address common.Address) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.unknown[tokenID{chainID, address}] = time.Now().Add(unknownTokenTTL)
+}
+
+// ensureToken registers the token of this chain in the collector when it is
+// seen for the first time. Tokens to buy live on the destination chain, so
+// they are registered by the indexer of that chain when matched.
+func (r *indexer) ensureToken(ctx context.Context, address common.Address) error {
+	if _, ok := r.tokens.get(r.chainID, address); ok {
+		return nil
+	}
+
+	log := r.log.WithField("token", address.String())
+	token, err := r.tokenMetadata(ctx, address)
+	if err != nil {
+		// the token is tried again next time it is seen, its amounts are not
+		// normalized until unknownTokenTTL passes
+		r.tokens.putUnknown(r.chainID, address)
+		log.WithError(err).Warn("failed to get token metadata, token is not registered")
+		return nil
+	}
+
+	u, _ := url.Parse("/tokens")
+	err = r.collector.PostJSON(ctx, u, requests.NewAddToken(token), nil)
+	if err != nil && !isConflict(err) {
+		return errors.Wrap(err, "failed to add token into collector service", logan.F{
+			"token": address.String(),
+		})
+	}
+
+	r.tokens.put(r.chainID, address, token)
+	log.WithFields(logan.F{
+		"symbol":   token.Symbol,
+		"decimals": token.Decimals,
+	}).Debug("token registered")
+	return nil
+}
+
+// tokenMetadata calls the token contract, the zero address is the native
+// asset described by the chain params in the collector
+func (r *indexer) tokenMetadata(ctx context.Context, address common.Address) (resources.TokenAttributes, error) {
+	token := resources.TokenAttributes{
+		Address:  address.String(),
+		SrcChain: r.chainID,
+	}
+
+	if address == (common.Address{}) {
+		chain, err := r.getChain(ctx, r.chainID)
+		if err != nil {
+			return token, errors.Wrap(err, "failed to get chain params")
+		}
+		token.Name = chain.Attributes.Name
+		token.Symbol = chain.Attributes.ChainParams.NativeSymbol
+		token.Decimals = chain.Attributes.ChainParams.NativeDecimals
+		return token, nil
+	}
+
+	var m erc20.Metadata
+	err := r.rpc(ctx, func(ctx context.Context) (err error) {
+		m, err = erc20.ReadMetadata(ctx, r.ethClient, address)
+		return err
+	})
+	if err != nil {
+		return token, errors.Wrap(err, "failed to read ERC20 metadata")
+	}
+	token.Name, token.Symbol, token.Decimals = m.Name, m.Symbol, m.Decimals
+	return token, nil
+}
+
+func (r *indexer) getChain(ctx context.Context, chainID int64) (*resources.Chain, error) {
+	u, _ := url.Parse("/chains/" + strconv.FormatInt(chainID, 10))
+
+	var resp resources.ChainResponse
+	if err := r.collector.Get(ctx, u, &resp); err != nil {
+		return nil, errors.Wrap(err, "failed to get chain from collector")
+	}
+	return &resp.Data, nil
+}
+
+// tokenDecimals returns false when the token is unknown. Tokens of other
+// chains are taken from the collector, where they are registered by the
+// indexers of their chains.
+func (r *indexer) tokenDecimals(ctx context.Context, chainID int64, address common.Address) (uint8, bool, error) {
+	if t, ok := r.tokens.get(chainID, address); ok {
+		return t.Decimals, true, nil
+	}
+	if r.tokens.isUnknown(chainID, address) {
+		return 0, false, nil
+	}
+
+	if chainID == r.chainID {
+		if err := r.ensureToken(ctx, address); err != nil {
+			return 0, false, err
+		}
+		t, ok := r.tokens.get(chainID, address)
+		return t.Decimals, ok, nil
+	}
+
+	t, err := r.getToken(ctx, chainID, address)
+	if err != nil {
+		return 0, false, err
+	}
+	if t == nil {
+		r.tokens.putUnknown(chainID, address)
+		return 0, false, nil
+	}
+	r.tokens.put(chainID, address, t.Attributes)
+	return t.Attributes.Decimals, true, nil
+}
+
+// getToken returns nil when the token is not registered in the collector
+func (r *indexer) getToken(ctx context.Context, chainID int64, address common.Address) (*resources.Token, error) {
+	u, _ := url.Parse("/tokens")
+	q := u.Query()
+	q.Set("filter[src_chain]", strconv.FormatInt(chainID, 10))
+	q.Set("filter[address]", address.String())
+	u.RawQuery = q.Encode()
+
+	var resp resources.TokenListResponse
+	if err := r.collector.Get(ctx, u, &resp); err != nil {
+		if cerrors.NotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to get token from collector", logan.F{
+			"chain_id": chainID,
+			"token":    address.String(),
+		})
+	}
+	if len(resp.Data) == 0 {
+		return nil, nil
+	}
+	return &resp.Data[0], nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"math/big"
+	"sync"
+
+	"github.com/Swapica/indexer-svc/internal/calldata"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gitlab.com/distributed_lab/logan/v3"
+)
+
+// txMemo keeps the last described transaction, because it is requested both
+// when the event is published and when it is archived
+type txMemo struct {
+	mu   sync.Mutex
+	hash common.Hash
+	tx   *calldata.Tx
+}
+
+// txDetails describes the transaction which emitted the event. It is used
+// for information only, so nil is returned instead of failing the indexing.
+func (r *indexer) txDetails(ctx context.Context, hash common.Hash) *calldata.Tx {
+	r.lastTx.mu.Lock()
+	defer r.lastTx.mu.Unlock()
+	if r.lastTx.tx != nil && r.lastTx.hash == hash {
+		return r.lastTx.tx
+	}
+
+	details := r.describeTx(ctx, hash)
+	if details != nil {
+		r.lastTx.hash, r.lastTx.tx = hash, details
+	}
+	return details
+}
+
+func (r *indexer) describeTx(ctx context.Context, hash common.Hash) *calldata.Tx {
+	log := r.log.WithField("tx_hash", hash.Hex())
+
+	var tx *types.Transaction
+	err := r.rpc(ctx, func(ctx context.Context) (err error) {
+		tx, _, err = r.ethClient.TransactionByHash(ctx, hash)
+		return err
+	})
+	if err != nil {
+		log.WithError(err).Warn("failed to get transaction")
+		return nil
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(big.NewInt(r.chainID)), tx)
+	if err != nil {
+		log.WithError(err).Warn("failed to recover transaction sender")
+		return nil
+	}
+	var receipt *types.Receipt
+	err = r.rpc(ctx, func(ctx context.Context) (err error) {
+		receipt, err = r.ethClient.TransactionReceipt(ctx, hash)
+		return err
+	})
+	if err != nil {
+		log.WithError(err).Warn("failed to get transaction receipt")
+		return nil
+	}
+
+	details := &calldata.Tx{
+		Sender:  sender.String(),
+		GasUsed: receipt.GasUsed,
+	}
+	if tx.To() != nil && *tx.To() == r.contractAddress {
+		details.Method, details.Signatures, err = calldata.Decode(r.swapicaAbi, tx.Data())
+		if err != nil {
+			log.WithError(err).Warn("failed to decode transaction input")
+		}
+	}
+	if len(r.relayers) != 0 {
+		_, byRelayer := r.relayers[sender]
+		details.ByRelayer = &byRelayer
+	}
+
+	log.WithFields(logan.F{
+		"sender": details.Sender,
+		"method": details.Method,
+	}).Debug("transaction decoded")
+	return details
+}
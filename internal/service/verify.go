@@ -0,0 +1,415 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+
+	"github.com/Swapica/indexer-svc/internal/config"
+	"github.com/Swapica/indexer-svc/internal/gobind"
+	"github.com/Swapica/indexer-svc/internal/service/state"
+	"github.com/Swapica/order-aggregator-svc/resources"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+const contractPageLimit = 100
+
+const (
+	DiffMissing  = "missing"
+	DiffExtra    = "extra"
+	DiffMismatch = "mismatch"
+)
+
+// Diff is a single difference between the contract and the collector
+type Diff struct {
+	Entity    string      `json:"entity"`
+	ID        int64       `json:"id"`
+	Kind      string      `json:"kind"`
+	Field     string      `json:"field,omitempty"`
+	Contract  interface{} `json:"contract,omitempty"`
+	Collector interface{} `json:"collector,omitempty"`
+	// Fixable is true when the difference can be fixed with the collector requests
+	Fixable bool `json:"fixable"`
+	Fixed   bool `json:"fixed"`
+}
+
+type VerifyOpts struct {
+	// Fix pushes the contract state to the collector
+	Fix bool
+	// EventsFrom enables use_relayer flag checks: the flag is not stored in
+	// the contract, so creation events are scanned from this block. Missing
+	// entities are added only when their flag was found.
+	EventsFrom *uint64
+}
+
+// Verify compares every order and match of the contract with the collector,
+// writes the differences to out in JSON and reports whether there are no
+// differences left
+func Verify(cfg config.Config, out io.Writer, opts VerifyOpts) (bool, error) {
+	r := newIndexer(cfg, 0)
+	ctx := context.Background()
+
+	diffs, err := r.verify(ctx, opts)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to verify collector state")
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(diffs); err != nil {
+		return false, errors.Wrap(err, "failed to encode diff")
+	}
+
+	for _, d := range diffs {
+		if !d.Fixed {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (r *indexer) verify(ctx context.Context, opts VerifyOpts) ([]Diff, error) {
+	var relayers *relayerFlags
+	if opts.EventsFrom != nil {
+		var err error
+		relayers, err = r.scanRelayerFlags(ctx, *opts.EventsFrom)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan relayer flags")
+		}
+	}
+
+	orders, err := r.verifyOrders(ctx, opts.Fix, relayers)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to verify orders")
+	}
+	matches, err := r.verifyMatches(ctx, opts.Fix, relayers)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to verify matches")
+	}
+
+	return append(orders, matches...), nil
+}
+
+func (r *indexer) verifyOrders(ctx context.Context, fix bool, relayers *relayerFlags) ([]Diff, error) {
+	diffs := make([]Diff, 0)
+	onChain := make(map[int64]bool)
+
+	err := r.forEachContractOrder(ctx, func(o gobind.ISwapicaOrder) error {
+		id := o.OrderId.Int64()
+		onChain[id] = true
+
+		collected, err := r.getOrder(ctx, id)
+		if err != nil {
+			return errors.Wrap(err, "failed to get order from collector", logan.F{"order_id": id})
+		}
+
+		if collected == nil {
+			// the order can't be added with a guessed use_relayer flag
+			useRelayer, known := relayers.order(id)
+			d := Diff{Entity: "order", ID: id, Kind: DiffMissing, Fixable: known}
+			if fix && known {
+				if _, err = r.addOrder(ctx, o, useRelayer); err != nil {
+					return errors.Wrap(err, "failed to add missing order", logan.F{"order_id": id})
+				}
+				d.Fixed = true
+			}
+			diffs = append(diffs, d)
+			return nil
+		}
+
+		diffs = append(diffs, r.compareOrder(ctx, fix, o, collected.Attributes, relayers)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	extra, err := extraEntities(ctx, r, "order", "/orders", onChain, func(o resources.Order) int64 {
+		return o.Attributes.OrderId
+	})
+	return append(diffs, extra...), err
+}
+
+func (r *indexer) compareOrder(
+	ctx context.Context, fix bool, o gobind.ISwapicaOrder, c resources.OrderAttributes, relayers *relayerFlags,
+) []Diff {
+	id := o.OrderId.Int64()
+	var diffs []Diff
+	mismatch := func(field string, contract, collector interface{}, fixable bool) {
+		diffs = append(diffs, Diff{
+			Entity: "order", ID: id, Kind: DiffMismatch, Field: field,
+			Contract: contract, Collector: collector, Fixable: fixable,
+		})
+	}
+
+	var statusChanged bool
+	if o.Status.State != c.State {
+		mismatch("state", state.State(o.Status.State).String(), state.State(c.State).String(), true)
+		statusChanged = true
+	}
+	var matchID *int64
+	if o.Status.MatchId != nil && o.Status.MatchId.Sign() != 0 {
+		mid := o.Status.MatchId.Int64()
+		matchID = &mid
+	}
+	if !equalInt64Ptr(matchID, c.MatchId) {
+		mismatch("match_id", matchID, c.MatchId, true)
+		statusChanged = true
+	}
+	if o.AmountToSell.String() != c.AmountToSell {
+		mismatch("amount_to_sell", o.AmountToSell.String(), c.AmountToSell, false)
+	}
+	if o.AmountToBuy.String() != c.AmountToBuy {
+		mismatch("amount_to_buy", o.AmountToBuy.String(), c.AmountToBuy, false)
+	}
+	if useRelayer, known := relayers.order(id); known && useRelayer != c.UseRelayer {
+		mismatch("use_relayer", useRelayer, c.UseRelayer, false)
+	}
+
+	if fix && statusChanged {
+		if err := r.patchOrder(ctx, o.OrderId, o.Status); err != nil {
+			r.log.WithError(err).WithField("order_id", id).Error("failed to fix order status")
+			return diffs
+		}
+		for i := range diffs {
+			diffs[i].Fixed = diffs[i].Fixable
+		}
+	}
+
+	return diffs
+}
+
+func (r *indexer) verifyMatches(ctx context.Context, fix bool, relayers *relayerFlags) ([]Diff, error) {
+	diffs := make([]Diff, 0)
+	onChain := make(map[int64]bool)
+
+	err := r.forEachContractMatch(ctx, func(m gobind.ISwapicaMatch) error {
+		id := m.MatchId.Int64()
+		onChain[id] = true
+
+		collected, err := r.getMatch(ctx, id)
+		if err != nil {
+			return errors.Wrap(err, "failed to get match from collector", logan.F{"match_id": id})
+		}
+
+		if collected == nil {
+			useRelayer, known := relayers.match(id)
+			d := Diff{Entity: "match", ID: id, Kind: DiffMissing, Fixable: known}
+			if fix && known {
+				if _, err = r.addMatch(ctx, m, useRelayer); err != nil {
+					return errors.Wrap(err, "failed to add missing match", logan.F{"match_id": id})
+				}
+				d.Fixed = true
+			}
+			diffs = append(diffs, d)
+			return nil
+		}
+
+		diffs = append(diffs, r.compareMatch(ctx, fix, m, collected.Attributes, relayers)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	extra, err := extraEntities(ctx, r, "match", "/match_orders", onChain, func(m resources.Match) int64 {
+		return m.Attributes.MatchId
+	})
+	return append(diffs, extra...), err
+}
+
+func (r *indexer) compareMatch(
+	ctx context.Context, fix bool, m gobind.ISwapicaMatch, c resources.MatchAttributes, relayers *relayerFlags,
+) []Diff {
+	id := m.MatchId.Int64()
+	var diffs []Diff
+	mismatch := func(field string, contract, collector interface{}, fixable bool) {
+		diffs = append(diffs, Diff{
+			Entity: "match", ID: id, Kind: DiffMismatch, Field: field,
+			Contract: contract, Collector: collector, Fixable: fixable,
+		})
+	}
+
+	if m.State != c.State {
+		mismatch("state", state.State(m.State).String(), state.State(c.State).String(), true)
+		if fix {
+			if err := r.patchMatch(ctx, m.MatchId, m.State); err != nil {
+				r.log.WithError(err).WithField("match_id", id).Error("failed to fix match state")
+			} else {
+				diffs[len(diffs)-1].Fixed = true
+			}
+		}
+	}
+	if m.OriginOrderId.Int64() != c.OriginOrderId {
+		mismatch("origin_order_id", m.OriginOrderId.Int64(), c.OriginOrderId, false)
+	}
+	if m.AmountToSell.String() != c.AmountToSell {
+		mismatch("amount_to_sell", m.AmountToSell.String(), c.AmountToSell, false)
+	}
+	if useRelayer, known := relayers.match(id); known && useRelayer != c.UseRelayer {
+		mismatch("use_relayer", useRelayer, c.UseRelayer, false)
+	}
+
+	return diffs
+}
+
+// extraEntities finds the collector entities of the chain that are absent in the contract
+func extraEntities[T any](ctx context.Context, r *indexer, entity, path string, onChain map[int64]bool, id func(T) int64) ([]Diff, error) {
+	collected, err := listCollected[T](ctx, r.collector, r.chainID, path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list collector entities", logan.F{"entity": entity})
+	}
+
+	var diffs []Diff
+	for _, c := range collected {
+		if !onChain[id(c)] {
+			diffs = append(diffs, Diff{Entity: entity, ID: id(c), Kind: DiffExtra})
+		}
+	}
+	return diffs, nil
+}
+
+func (r *indexer) forEachContractOrder(ctx context.Context, fn func(gobind.ISwapicaOrder) error) error {
+	var length *big.Int
+	err := r.rpc(ctx, func(ctx context.Context) (err error) {
+		length, err = r.swapica.GetAllOrdersLength(&bind.CallOpts{Context: ctx})
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to get orders length")
+	}
+
+	limit := big.NewInt(contractPageLimit)
+	for offset := new(big.Int); offset.Cmp(length) < 0; offset = new(big.Int).Add(offset, limit) {
+		var orders []gobind.ISwapicaOrder
+		err := r.rpc(ctx, func(ctx context.Context) (err error) {
+			orders, err = r.swapica.GetAllOrders(&bind.CallOpts{Context: ctx}, offset, limit)
+			return err
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get orders", logan.F{"offset": offset.String()})
+		}
+		for _, o := range orders {
+			if err = fn(o); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *indexer) forEachContractMatch(ctx context.Context, fn func(gobind.ISwapicaMatch) error) error {
+	var length *big.Int
+	err := r.rpc(ctx, func(ctx context.Context) (err error) {
+		length, err = r.swapica.GetAllMatchesLength(&bind.CallOpts{Context: ctx})
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to get matches length")
+	}
+
+	limit := big.NewInt(contractPageLimit)
+	for offset := new(big.Int); offset.Cmp(length) < 0; offset = new(big.Int).Add(offset, limit) {
+		var matches []gobind.ISwapicaMatch
+		err := r.rpc(ctx, func(ctx context.Context) (err error) {
+			matches, err = r.swapica.GetAllMatches(&bind.CallOpts{Context: ctx}, offset, limit)
+			return err
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get matches", logan.F{"offset": offset.String()})
+		}
+		for _, m := range matches {
+			if err = fn(m); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// relayerFlags keeps use_relayer of the created entities, nil value means
+// the flags are unknown
+type relayerFlags struct {
+	orders  map[int64]bool
+	matches map[int64]bool
+	// logs are the creation logs of the scanned entities
+	logs map[entityKey]types.Log
+}
+
+// order reports whether the flag is known: it is not without the scan and for
+// the orders created before the scanned blocks
+func (f *relayerFlags) order(id int64) (useRelayer, known bool) {
+	if f == nil {
+		return false, false
+	}
+	useRelayer, known = f.orders[id]
+	return useRelayer, known
+}
+
+func (f *relayerFlags) match(id int64) (useRelayer, known bool) {
+	if f == nil {
+		return false, false
+	}
+	useRelayer, known = f.matches[id]
+	return useRelayer, known
+}
+
+func (r *indexer) scanRelayerFlags(ctx context.Context, from uint64) (*relayerFlags, error) {
+	flags := relayerFlags{
+		orders:  make(map[int64]bool),
+		matches: make(map[int64]bool),
+		logs:    make(map[entityKey]types.Log),
+	}
+
+	head, err := r.blockNumber(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get last block number")
+	}
+
+	query := r.filters()
+	query.Topics = [][]common.Hash{{
+		r.swapicaAbi.Events["OrderCreated"].ID,
+		r.swapicaAbi.Events["MatchCreated"].ID,
+	}}
+
+	err = r.forEachLog(ctx, query, from, head, func(log types.Log) error {
+		event, err := r.swapicaAbi.EventByID(log.Topics[0])
+		if err != nil {
+			return errors.Wrap(err, "failed to get event by topic")
+		}
+
+		switch event.Name {
+		case "OrderCreated":
+			var e gobind.SwapicaOrderCreated
+			if err = r.swapicaAbi.UnpackIntoInterface(&e, event.Name, log.Data); err != nil {
+				return errors.Wrap(err, "failed to unpack event", logan.F{"event": event.Name})
+			}
+			flags.orders[e.Order.OrderId.Int64()] = e.UseRelayer
+			flags.logs[entityKey{entity: EntityOrder, id: e.Order.OrderId.Int64()}] = log
+		case "MatchCreated":
+			var e gobind.SwapicaMatchCreated
+			if err = r.swapicaAbi.UnpackIntoInterface(&e, event.Name, log.Data); err != nil {
+				return errors.Wrap(err, "failed to unpack event", logan.F{"event": event.Name})
+			}
+			flags.matches[e.Match.MatchId.Int64()] = e.UseRelayer
+			flags.logs[entityKey{entity: EntityMatch, id: e.Match.MatchId.Int64()}] = log
+		}
+		return nil
+	})
+
+	return &flags, err
+}
+
+func equalInt64Ptr(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Swapica/indexer-svc/internal/metrics"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// watchdog notices when the chain stops producing blocks and when the
+// subscription stops delivering while the connection stays open
+type watchdog struct {
+	stallTimeout time.Duration
+	maxLag       uint64
+
+	head        uint64
+	headMovedAt time.Time
+	// wsHead is the last head delivered by the websocket subscription, the
+	// events are too rare to tell a stalled subscription from a quiet contract
+	wsHead uint64
+}
+
+func newWatchdog(stallTimeout time.Duration, maxLag uint64) *watchdog {
+	return &watchdog{
+		stallTimeout: stallTimeout,
+		maxLag:       maxLag,
+		headMovedAt:  time.Now(),
+	}
+}
+
+// checkChain raises an alert when the head reported by RPC did not change
+// for longer than stall_timeout
+func (r *indexer) checkChain(ctx context.Context) (uint64, error) {
+	head, err := r.blockNumber(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get last block number")
+	}
+
+	w := r.watchdog
+	if head > w.head {
+		w.head = head
+		w.headMovedAt = time.Now()
+		return head, nil
+	}
+
+	if stalled := time.Since(w.headMovedAt); stalled > w.stallTimeout {
+		metrics.Stalls.Add("chain", 1)
+		r.log.WithFields(logan.F{
+			"head":          head,
+			"stalled_for":   stalled.String(),
+			"stall_timeout": w.stallTimeout.String(),
+		}).Error("chain head is not advancing")
+	}
+
+	return head, nil
+}
+
+// checkSubscription returns errSubscriptionFailed to force resubscribe when
+// the websocket heads fell behind the RPC head more than max_lag_blocks
+func (r *indexer) checkSubscription(ctx context.Context) error {
+	head, err := r.checkChain(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := r.watchdog
+	if w.wsHead == 0 || head <= w.wsHead || head-w.wsHead <= w.maxLag {
+		return nil
+	}
+
+	metrics.Stalls.Add("subscription", 1)
+	fields := logan.F{
+		"head":    head,
+		"ws_head": w.wsHead,
+		"max_lag": w.maxLag,
+	}
+	r.log.WithFields(fields).Error("websocket subscription is stalled")
+	return errors.From(errSubscriptionFailed, fields)
+}
@@ -0,0 +1,85 @@
+package sink
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/Swapica/indexer-svc/internal/retry"
+	jsonapi "gitlab.com/distributed_lab/json-api-connector"
+	"gitlab.com/distributed_lab/json-api-connector/cerrors"
+	"gitlab.com/distributed_lab/json-api-connector/client"
+)
+
+// Client is the collector connector that binds every request to ctx and
+// retries the transient failures within the budget
+type Client struct {
+	client client.Client
+	budget retry.Budget
+}
+
+func NewClient(c client.Client, budget retry.Budget) *Client {
+	return &Client{client: c, budget: budget}
+}
+
+func (c *Client) Get(ctx context.Context, endpoint *url.URL, dst interface{}) error {
+	return c.do(ctx, func(_ context.Context, conn *jsonapi.Connector) error {
+		return conn.Get(endpoint, dst)
+	})
+}
+
+func (c *Client) PostJSON(ctx context.Context, endpoint *url.URL, req interface{}, dst interface{}) error {
+	return c.do(ctx, func(ctx context.Context, conn *jsonapi.Connector) error {
+		return conn.PostJSON(endpoint, req, ctx, dst)
+	})
+}
+
+func (c *Client) PatchJSON(ctx context.Context, endpoint *url.URL, req interface{}, dst interface{}) error {
+	return c.do(ctx, func(ctx context.Context, conn *jsonapi.Connector) error {
+		return conn.PatchJSON(endpoint, req, ctx, dst)
+	})
+}
+
+func (c *Client) Delete(ctx context.Context, endpoint *url.URL, dst interface{}) error {
+	return c.do(ctx, func(_ context.Context, conn *jsonapi.Connector) error {
+		return conn.Delete(endpoint, dst)
+	})
+}
+
+// do makes a connector for every attempt, because the connector does not
+// accept the context for all the methods
+func (c *Client) do(ctx context.Context, fn func(ctx context.Context, conn *jsonapi.Connector) error) error {
+	return c.budget.Do(ctx, Transient, func(ctx context.Context) error {
+		return fn(ctx, jsonapi.NewConnector(contextClient{Client: c.client, ctx: ctx}))
+	})
+}
+
+// Transient reports whether the collector request may succeed when repeated:
+// the request was not performed, or the collector failed with 5xx or 429
+func Transient(err error) bool {
+	cerr, ok := err.(cerrors.Error)
+	if !ok {
+		return false
+	}
+	return cerr.Status() == 0 || cerr.Status() >= http.StatusInternalServerError
+}
+
+type contextClient struct {
+	client.Client
+	ctx context.Context
+}
+
+// errTooManyRequests replaces the 429 response, the connector panics on it
+var errTooManyRequests = cerrors.New("too many requests")
+
+func (c contextClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.Client.Do(req.WithContext(c.ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		_ = resp.Body.Close()
+		return nil, errTooManyRequests
+	}
+	return resp, nil
+}
@@ -0,0 +1,176 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	DivergenceMissing   = "missing"
+	DivergenceExtra     = "extra"
+	DivergenceDifferent = "different"
+)
+
+// Divergence is a write of a log made by only one of the compared streams, or
+// made by both of them with different bodies
+type Divergence struct {
+	Kind     string          `json:"kind"`
+	Block    uint64          `json:"block"`
+	LogIndex uint            `json:"log_index"`
+	Method   string          `json:"method"`
+	Path     string          `json:"path"`
+	Expected json.RawMessage `json:"expected,omitempty"`
+	Actual   json.RawMessage `json:"actual,omitempty"`
+}
+
+// Diff compares the writes of the logs present in both streams. The block
+// writes and the token registrations are skipped: they depend on where each
+// indexer started and on its token cache, not on the handlers. The writes
+// made outside event handling are skipped too.
+func Diff(expected, actual []Write) []Divergence {
+	from, to, ok := commonRange(expected, actual)
+	if !ok {
+		return nil
+	}
+
+	exp := groupByLog(expected, from, to)
+	act := groupByLog(actual, from, to)
+
+	keys := make([]logKey, 0, len(exp)+len(act))
+	for k := range exp {
+		keys = append(keys, k)
+	}
+	for k := range act {
+		if _, ok := exp[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].before(keys[j]) })
+
+	var result []Divergence
+	for _, k := range keys {
+		result = append(result, diffLog(exp[k], act[k])...)
+	}
+	return result
+}
+
+type logKey struct {
+	block uint64
+	index uint
+}
+
+func (k logKey) before(other logKey) bool {
+	return k.block < other.block || k.block == other.block && k.index < other.index
+}
+
+func diffable(w Write) bool {
+	if w.Block == 0 || w.Method == http.MethodPost && (strings.HasSuffix(w.Path, "/block") || w.Path == "/tokens") {
+		return false
+	}
+	return true
+}
+
+// commonRange returns the blocks processed by both indexers
+func commonRange(expected, actual []Write) (from, to uint64, ok bool) {
+	expFrom, expTo, expOK := blockRange(expected)
+	actFrom, actTo, actOK := blockRange(actual)
+	if !expOK || !actOK {
+		return 0, 0, false
+	}
+
+	from, to = expFrom, expTo
+	if actFrom > from {
+		from = actFrom
+	}
+	if actTo < to {
+		to = actTo
+	}
+	return from, to, from <= to
+}
+
+func blockRange(writes []Write) (from, to uint64, ok bool) {
+	for _, w := range writes {
+		if w.Block == 0 {
+			continue
+		}
+		if !ok || w.Block < from {
+			from = w.Block
+		}
+		if !ok || w.Block > to {
+			to = w.Block
+		}
+		ok = true
+	}
+	return from, to, ok
+}
+
+func groupByLog(writes []Write, from, to uint64) map[logKey][]Write {
+	result := make(map[logKey][]Write)
+	for _, w := range writes {
+		if !diffable(w) || w.Block < from || w.Block > to {
+			continue
+		}
+		k := logKey{block: w.Block, index: w.LogIndex}
+		result[k] = append(result[k], w)
+	}
+	return result
+}
+
+// diffLog compares the writes of a single log in their order, the writes made
+// again right after the same write, e.g. after a restart, are compared once
+func diffLog(expected, actual []Write) []Divergence {
+	expected, actual = dedup(expected), dedup(actual)
+
+	var result []Divergence
+	for i := 0; i < len(expected) || i < len(actual); i++ {
+		switch {
+		case i >= len(actual):
+			result = append(result, newDivergence(DivergenceMissing, expected[i], expected[i].Body, nil))
+		case i >= len(expected):
+			result = append(result, newDivergence(DivergenceExtra, actual[i], nil, actual[i].Body))
+		case expected[i].Method != actual[i].Method || expected[i].Path != actual[i].Path ||
+			!sameJSON(expected[i].Body, actual[i].Body):
+			result = append(result, newDivergence(DivergenceDifferent, actual[i], expected[i].Body, actual[i].Body))
+		}
+	}
+	return result
+}
+
+// newDivergence takes the position, the method and the path from w
+func newDivergence(kind string, w Write, expected, actual json.RawMessage) Divergence {
+	return Divergence{
+		Kind:     kind,
+		Block:    w.Block,
+		LogIndex: w.LogIndex,
+		Method:   w.Method,
+		Path:     w.Path,
+		Expected: expected,
+		Actual:   actual,
+	}
+}
+
+func dedup(writes []Write) []Write {
+	result := make([]Write, 0, len(writes))
+	for _, w := range writes {
+		if n := len(result); n != 0 && result[n-1].Method == w.Method && result[n-1].Path == w.Path &&
+			sameJSON(result[n-1].Body, w.Body) {
+			continue
+		}
+		result = append(result, w)
+	}
+	return result
+}
+
+// sameJSON compares the bodies ignoring the formatting and the key order
+func sameJSON(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return bytes.Equal(a, b)
+	}
+	ra, _ := json.Marshal(va)
+	rb, _ := json.Marshal(vb)
+	return bytes.Equal(ra, rb)
+}
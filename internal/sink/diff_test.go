@@ -0,0 +1,93 @@
+package sink
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func write(block uint64, index uint, method, path, body string) Write {
+	w := Write{Block: block, LogIndex: index, Method: method, Path: path}
+	if body != "" {
+		w.Body = json.RawMessage(body)
+	}
+	return w
+}
+
+func TestDedup(t *testing.T) {
+	post := write(1, 0, http.MethodPost, "/orders", `{"id":1,"state":1}`)
+	reordered := write(1, 0, http.MethodPost, "/orders", `{ "state": 1, "id": 1 }`)
+	patch := write(1, 0, http.MethodPatch, "5/orders", `{"id":1,"state":4}`)
+
+	cases := []struct {
+		name   string
+		writes []Write
+		want   int
+	}{
+		{name: "empty", writes: nil, want: 0},
+		{name: "single", writes: []Write{post}, want: 1},
+		{name: "repeated", writes: []Write{post, post, post}, want: 1},
+		{name: "repeated with other key order", writes: []Write{post, reordered}, want: 1},
+		{name: "different writes", writes: []Write{post, patch}, want: 2},
+		{name: "repeated after another write", writes: []Write{post, patch, post}, want: 3},
+	}
+	for _, c := range cases {
+		if got := dedup(c.writes); len(got) != c.want {
+			t.Errorf("%s: got %d writes, want %d", c.name, len(got), c.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	order := write(10, 0, http.MethodPost, "/orders", `{"id":1}`)
+	update := write(11, 2, http.MethodPatch, "5/orders", `{"id":1,"state":4}`)
+	changed := write(11, 2, http.MethodPatch, "5/orders", `{"id":1,"state":3}`)
+	match := write(12, 0, http.MethodPost, "/match_orders", `{"id":1}`)
+	block := write(11, 2, http.MethodPost, "5/block", `{"number":11}`)
+	token := write(11, 2, http.MethodPost, "/tokens", `{"address":"0x1"}`)
+	outside := write(0, 0, http.MethodPatch, "5/orders", `{"id":2}`)
+
+	cases := []struct {
+		name     string
+		expected []Write
+		actual   []Write
+		want     []string
+	}{
+		{name: "same", expected: []Write{order, update}, actual: []Write{order, update}},
+		{name: "nothing in common", expected: []Write{order}, actual: nil},
+		{name: "missing", expected: []Write{order, update, match}, actual: []Write{order, match}, want: []string{DivergenceMissing}},
+		{name: "extra", expected: []Write{order, match}, actual: []Write{order, update, match}, want: []string{DivergenceExtra}},
+		{name: "different", expected: []Write{order, update}, actual: []Write{order, changed}, want: []string{DivergenceDifferent}},
+		{name: "repeated write", expected: []Write{order, update}, actual: []Write{order, order, update}},
+		{name: "block and token writes skipped", expected: []Write{order, update}, actual: []Write{order, block, token, update}},
+		{name: "writes outside events skipped", expected: []Write{order, update}, actual: []Write{order, outside, update}},
+		{name: "blocks outside common range skipped", expected: []Write{order, update}, actual: []Write{update, match}},
+		{
+			name:     "actual in other order",
+			expected: []Write{order, update, match},
+			actual:   []Write{match, changed},
+			want:     []string{DivergenceDifferent},
+		},
+		{
+			name:     "several divergences in log order",
+			expected: []Write{order, update, match},
+			actual:   []Write{order, changed, write(12, 0, http.MethodPost, "/match_orders", `{"id":2}`)},
+			want:     []string{DivergenceDifferent, DivergenceDifferent},
+		},
+	}
+	for _, c := range cases {
+		got := Diff(c.expected, c.actual)
+		if len(got) != len(c.want) {
+			t.Errorf("%s: got %d divergences %+v, want %v", c.name, len(got), got, c.want)
+			continue
+		}
+		for i, d := range got {
+			if d.Kind != c.want[i] {
+				t.Errorf("%s: divergence %d is %q, want %q", c.name, i, d.Kind, c.want[i])
+			}
+			if i > 0 && (logKey{d.Block, d.LogIndex}).before(logKey{got[i-1].Block, got[i-1].LogIndex}) {
+				t.Errorf("%s: divergence %d is before the previous one", c.name, i)
+			}
+		}
+	}
+}
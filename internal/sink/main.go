@@ -0,0 +1,140 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// Collector is the collector client used by the indexer, it is implemented by
+// Client and by the sinks wrapping it
+type Collector interface {
+	Get(ctx context.Context, endpoint *url.URL, dst interface{}) error
+	PostJSON(ctx context.Context, endpoint *url.URL, req interface{}, dst interface{}) error
+	PatchJSON(ctx context.Context, endpoint *url.URL, req interface{}, dst interface{}) error
+	Delete(ctx context.Context, endpoint *url.URL, dst interface{}) error
+}
+
+// Write is a single collector write with the position of the log it was made
+// for, the position is zero for the writes made outside event handling
+type Write struct {
+	Block    uint64          `json:"block"`
+	LogIndex uint            `json:"log_index"`
+	Method   string          `json:"method"`
+	Path     string          `json:"path"`
+	Body     json.RawMessage `json:"body,omitempty"`
+}
+
+type positionKey struct{}
+
+type position struct {
+	block uint64
+	index uint
+}
+
+// WithPosition returns ctx marking the writes made with it as the writes of
+// the log at block and index
+func WithPosition(ctx context.Context, block uint64, index uint) context.Context {
+	return context.WithValue(ctx, positionKey{}, position{block: block, index: index})
+}
+
+func newWrite(ctx context.Context, method string, endpoint *url.URL, req interface{}) (Write, error) {
+	w := Write{Method: method, Path: endpoint.String()}
+	if pos, ok := ctx.Value(positionKey{}).(position); ok {
+		w.Block, w.LogIndex = pos.block, pos.index
+	}
+	if req == nil {
+		return w, nil
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return w, errors.Wrap(err, "failed to marshal request body")
+	}
+	w.Body = body
+	return w, nil
+}
+
+// Appender keeps the writes made through the sinks
+type Appender interface {
+	Append(w Write) error
+}
+
+// Log appends the writes to the JSONL file, it is safe for concurrent use
+type Log struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// OpenLog appends to the existing file
+func OpenLog(path string) (*Log, error) {
+	return openLog(path, os.O_APPEND)
+}
+
+// CreateLog truncates the existing file
+func CreateLog(path string) (*Log, error) {
+	return openLog(path, os.O_TRUNC)
+}
+
+func openLog(path string, flag int) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|flag, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open write log")
+	}
+	return &Log{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (l *Log) Append(w Write) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return errors.Wrap(l.enc.Encode(w), "failed to append write")
+}
+
+func (l *Log) Close() error {
+	return l.file.Close()
+}
+
+type entryLog struct {
+	log *logan.Entry
+}
+
+// LogEntries writes every write to log at info level
+func LogEntries(log *logan.Entry) Appender {
+	return entryLog{log: log}
+}
+
+func (l entryLog) Append(w Write) error {
+	l.log.WithFields(logan.F{
+		"block":     w.Block,
+		"log_index": w.LogIndex,
+		"method":    w.Method,
+		"path":      w.Path,
+		"body":      string(w.Body),
+	}).Info("collector write skipped")
+	return nil
+}
+
+// ReadWrites reads the JSONL writes written by Log
+func ReadWrites(r io.Reader) ([]Write, error) {
+	var result []Write
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var w Write
+		err := dec.Decode(&w)
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode write", logan.F{"line": len(result) + 1})
+		}
+		result = append(result, w)
+	}
+}
@@ -0,0 +1,47 @@
+package sink
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Recorder passes all the requests to the collector and appends the
+// successful writes to the log
+type Recorder struct {
+	Collector
+	log Appender
+}
+
+func NewRecorder(c Collector, log Appender) *Recorder {
+	return &Recorder{Collector: c, log: log}
+}
+
+func (r *Recorder) PostJSON(ctx context.Context, endpoint *url.URL, req interface{}, dst interface{}) error {
+	if err := r.Collector.PostJSON(ctx, endpoint, req, dst); err != nil {
+		return err
+	}
+	return r.record(ctx, http.MethodPost, endpoint, req)
+}
+
+func (r *Recorder) PatchJSON(ctx context.Context, endpoint *url.URL, req interface{}, dst interface{}) error {
+	if err := r.Collector.PatchJSON(ctx, endpoint, req, dst); err != nil {
+		return err
+	}
+	return r.record(ctx, http.MethodPatch, endpoint, req)
+}
+
+func (r *Recorder) Delete(ctx context.Context, endpoint *url.URL, dst interface{}) error {
+	if err := r.Collector.Delete(ctx, endpoint, dst); err != nil {
+		return err
+	}
+	return r.record(ctx, http.MethodDelete, endpoint, nil)
+}
+
+func (r *Recorder) record(ctx context.Context, method string, endpoint *url.URL, req interface{}) error {
+	w, err := newWrite(ctx, method, endpoint, req)
+	if err != nil {
+		return err
+	}
+	return r.log.Append(w)
+}
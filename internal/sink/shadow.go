@@ -0,0 +1,297 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Swapica/order-aggregator-svc/resources"
+	"gitlab.com/distributed_lab/json-api-connector/cerrors"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+// Shadow never writes to the collector. It keeps the orders, matches and the
+// last block of the chain written to it and serves their reads itself, all the
+// other reads, e.g. tokens and the orders of other chains, are passed to the
+// collector. Every accepted write is appended to the log.
+type Shadow struct {
+	base     Collector
+	log      Appender
+	chainID  string
+	fallback bool
+
+	mu      sync.Mutex
+	orders  map[int64]resources.Order
+	matches map[int64]resources.Match
+	block   *resources.BlockResponse
+}
+
+type ShadowOpts struct {
+	ChainID int64
+	// Fallback reads the orders, matches and the block unknown to the shadow
+	// from the collector, so the shadow continues from the collector state
+	// instead of the empty one
+	Fallback bool
+}
+
+func NewShadow(base Collector, log Appender, opts ShadowOpts) *Shadow {
+	return &Shadow{
+		base:     base,
+		log:      log,
+		chainID:  strconv.FormatInt(opts.ChainID, 10),
+		fallback: opts.Fallback,
+		orders:   make(map[int64]resources.Order),
+		matches:  make(map[int64]resources.Match),
+	}
+}
+
+func (s *Shadow) Get(ctx context.Context, endpoint *url.URL, dst interface{}) error {
+	s.mu.Lock()
+	resp, served, err := s.get(endpoint.Path)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if !served {
+		return s.base.Get(ctx, endpoint, dst)
+	}
+	if resp == nil {
+		return notFound(endpoint)
+	}
+	if dst == nil {
+		return nil
+	}
+
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal response")
+	}
+	return json.Unmarshal(raw, dst)
+}
+
+// get reports whether the path is served by the shadow, resp is nil when the
+// entity is not found
+func (s *Shadow) get(path string) (resp interface{}, served bool, err error) {
+	switch {
+	case path == s.chainID+"/block":
+		if s.block != nil {
+			return s.block, true, nil
+		}
+		return nil, !s.fallback, nil
+	case strings.HasPrefix(path, "/orders/"):
+		id, err := strconv.ParseInt(strings.TrimPrefix(path, "/orders/"), 10, 64)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "failed to parse order id")
+		}
+		if o, ok := s.orders[id]; ok {
+			return resources.OrderResponse{Data: o}, true, nil
+		}
+		return nil, !s.fallback, nil
+	case strings.HasPrefix(path, "/match_orders/"):
+		id, err := strconv.ParseInt(strings.TrimPrefix(path, "/match_orders/"), 10, 64)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "failed to parse match id")
+		}
+		if m, ok := s.matches[id]; ok {
+			return resources.MatchResponse{Data: m}, true, nil
+		}
+		return nil, !s.fallback, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+func (s *Shadow) PostJSON(ctx context.Context, endpoint *url.URL, req interface{}, _ interface{}) error {
+	w, err := newWrite(ctx, http.MethodPost, endpoint, req)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch endpoint.Path {
+	case "/orders":
+		var body resources.AddOrderRequest
+		if err = json.Unmarshal(w.Body, &body); err != nil {
+			return errors.Wrap(err, "failed to unmarshal order")
+		}
+		attrs := body.Data.Attributes
+		if strconv.FormatInt(attrs.SrcChainId, 10) != s.chainID {
+			break
+		}
+		if _, ok, err := s.order(ctx, attrs.OrderId); err != nil || ok {
+			return orConflict(err, endpoint)
+		}
+		s.orders[attrs.OrderId] = resources.Order{
+			Key: resources.NewKeyInt64(attrs.OrderId, resources.ORDER),
+			Attributes: resources.OrderAttributes{
+				AmountToBuy:  attrs.AmountToBuy,
+				AmountToSell: attrs.AmountToSell,
+				Creator:      attrs.Creator,
+				MatchId:      attrs.MatchId,
+				MatchSwapica: attrs.MatchSwapica,
+				OrderId:      attrs.OrderId,
+				State:        attrs.State,
+				UseRelayer:   attrs.UseRelayer,
+			},
+		}
+	case "/match_orders":
+		var body resources.AddMatchRequest
+		if err = json.Unmarshal(w.Body, &body); err != nil {
+			return errors.Wrap(err, "failed to unmarshal match")
+		}
+		attrs := body.Data.Attributes
+		if _, ok, err := s.match(ctx, attrs.MatchId); err != nil || ok {
+			return orConflict(err, endpoint)
+		}
+		s.matches[attrs.MatchId] = resources.Match{
+			Key: resources.NewKeyInt64(attrs.MatchId, resources.MATCH_ORDER),
+			Attributes: resources.MatchAttributes{
+				AmountToSell:  attrs.AmountToSell,
+				Creator:       attrs.Creator,
+				MatchId:       attrs.MatchId,
+				OriginOrderId: attrs.OriginOrderId,
+				State:         attrs.State,
+				UseRelayer:    attrs.UseRelayer,
+			},
+		}
+	case s.chainID + "/block":
+		var body resources.BlockResponse
+		if err = json.Unmarshal(w.Body, &body); err != nil {
+			return errors.Wrap(err, "failed to unmarshal block")
+		}
+		s.block = &body
+	}
+
+	return s.log.Append(w)
+}
+
+func (s *Shadow) PatchJSON(ctx context.Context, endpoint *url.URL, req interface{}, _ interface{}) error {
+	w, err := newWrite(ctx, http.MethodPatch, endpoint, req)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch endpoint.Path {
+	case s.chainID + "/orders":
+		var body resources.UpdateOrderRequest
+		if err = json.Unmarshal(w.Body, &body); err != nil {
+			return errors.Wrap(err, "failed to unmarshal order update")
+		}
+		id, err := strconv.ParseInt(body.Data.ID, 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "failed to parse order id")
+		}
+		o, ok, err := s.order(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return notFound(endpoint)
+		}
+		attrs := body.Data.Attributes
+		o.Attributes.State, o.Attributes.MatchId, o.Attributes.MatchSwapica = attrs.State, attrs.MatchId, attrs.MatchSwapica
+		s.orders[id] = o
+	case s.chainID + "/match_orders":
+		var body resources.UpdateMatchRequest
+		if err = json.Unmarshal(w.Body, &body); err != nil {
+			return errors.Wrap(err, "failed to unmarshal match update")
+		}
+		id, err := strconv.ParseInt(body.Data.ID, 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "failed to parse match id")
+		}
+		m, ok, err := s.match(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return notFound(endpoint)
+		}
+		m.Attributes.State = body.Data.Attributes.State
+		s.matches[id] = m
+	}
+
+	return s.log.Append(w)
+}
+
+func (s *Shadow) Delete(ctx context.Context, endpoint *url.URL, _ interface{}) error {
+	w, err := newWrite(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch endpoint.Path {
+	case s.chainID + "/orders":
+		s.orders = make(map[int64]resources.Order)
+	case s.chainID + "/match_orders":
+		s.matches = make(map[int64]resources.Match)
+	}
+
+	return s.log.Append(w)
+}
+
+// order looks for the order in the collector when the shadow does not know it
+// and the fallback is enabled
+func (s *Shadow) order(ctx context.Context, id int64) (resources.Order, bool, error) {
+	if o, ok := s.orders[id]; ok {
+		return o, true, nil
+	}
+	var resp resources.OrderResponse
+	ok, err := s.load(ctx, "/orders/"+strconv.FormatInt(id, 10), &resp)
+	return resp.Data, ok, err
+}
+
+func (s *Shadow) match(ctx context.Context, id int64) (resources.Match, bool, error) {
+	if m, ok := s.matches[id]; ok {
+		return m, true, nil
+	}
+	var resp resources.MatchResponse
+	ok, err := s.load(ctx, "/match_orders/"+strconv.FormatInt(id, 10), &resp)
+	return resp.Data, ok, err
+}
+
+func (s *Shadow) load(ctx context.Context, path string, dst interface{}) (bool, error) {
+	if !s.fallback {
+		return false, nil
+	}
+
+	u, _ := url.Parse(path)
+	err := s.base.Get(ctx, u, dst)
+	if cerrors.NotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed to read collector")
+	}
+	return true, nil
+}
+
+// orConflict returns err if it is not nil and the conflict error otherwise
+func orConflict(err error, endpoint *url.URL) error {
+	if err != nil {
+		return err
+	}
+	return conflict(endpoint)
+}
+
+// notFound and conflict are the same errors the connector returns, so the
+// indexer handles them in the same way
+func notFound(endpoint *url.URL) error {
+	return cerrors.E("not found", cerrors.Status(http.StatusNotFound), cerrors.Path(endpoint.String()))
+}
+
+func conflict(endpoint *url.URL) error {
+	return cerrors.E("request conflicts with current state", cerrors.Status(http.StatusConflict), cerrors.Path(endpoint.String()))
+}
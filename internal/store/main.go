@@ -0,0 +1,430 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Swapica/indexer-svc/internal/amount"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+type Order struct {
+	OrderID          int64   `json:"order_id"`
+	Creator          string  `json:"creator"`
+	TokenToSell      string  `json:"token_to_sell"`
+	AmountToSell     string  `json:"amount_to_sell"`
+	TokenToBuy       string  `json:"token_to_buy"`
+	AmountToBuy      string  `json:"amount_to_buy"`
+	DestinationChain int64   `json:"destination_chain"`
+	State            uint8   `json:"state"`
+	MatchID          *int64  `json:"match_id,omitempty"`
+	MatchSwapica     *string `json:"match_swapica,omitempty"`
+	UseRelayer       bool    `json:"use_relayer"`
+	amount.Normalized
+}
+
+type Match struct {
+	MatchID       int64  `json:"match_id"`
+	Creator       string `json:"creator"`
+	TokenToSell   string `json:"token_to_sell"`
+	AmountToSell  string `json:"amount_to_sell"`
+	OriginChain   int64  `json:"origin_chain"`
+	OriginOrderID int64  `json:"origin_order_id"`
+	State         uint8  `json:"state"`
+	UseRelayer    bool   `json:"use_relayer"`
+	amount.Normalized
+}
+
+// Store keeps the indexed orders and matches of a single chain in memory.
+// When path is set, every change is appended to the file, which is compacted
+// into a single snapshot record once the changes outnumber the entities.
+type Store struct {
+	mu           sync.RWMutex
+	path         string
+	file         *os.File
+	changes      int
+	bootstrapped bool
+	orders       map[int64]Order
+	matches      map[int64]Match
+}
+
+// compactMinChanges keeps small stores from being compacted too often
+const compactMinChanges = 1000
+
+// record is a line of the store file with the changed entities, or with all
+// of them when Reset is set
+type record struct {
+	Reset        bool    `json:"reset,omitempty"`
+	Bootstrapped bool    `json:"bootstrapped,omitempty"`
+	Orders       []Order `json:"orders,omitempty"`
+	Matches      []Match `json:"matches,omitempty"`
+}
+
+// New loads the file from path and compacts it, the store is not persisted
+// when path is empty
+func New(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		orders:  make(map[int64]Order),
+		matches: make(map[int64]Match),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load ignores the torn last record left by an interrupted append, it is
+// dropped by the compaction
+func (s *Store) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to open store file")
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		raw, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return errors.Wrap(err, "failed to read store file")
+		}
+		last := err == io.EOF
+		if len(bytes.TrimSpace(raw)) == 0 {
+			if last {
+				return nil
+			}
+			continue
+		}
+
+		var rec record
+		if err = json.Unmarshal(raw, &rec); err != nil {
+			if last {
+				return nil
+			}
+			return errors.Wrap(err, "failed to unmarshal store record", logan.F{"line": line})
+		}
+		s.apply(rec)
+		if last {
+			return nil
+		}
+	}
+}
+
+func (s *Store) apply(rec record) {
+	if rec.Reset {
+		s.orders = make(map[int64]Order)
+		s.matches = make(map[int64]Match)
+		s.bootstrapped = false
+	}
+	if rec.Bootstrapped {
+		s.bootstrapped = true
+	}
+	for _, o := range rec.Orders {
+		s.orders[o.OrderID] = o
+	}
+	for _, m := range rec.Matches {
+		s.matches[m.MatchID] = m
+	}
+}
+
+// Close closes the store file, the store must not be changed after it
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	return errors.Wrap(s.file.Close(), "failed to close store file")
+}
+
+func (s *Store) PutOrder(o Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orders[o.OrderID] = o
+	return s.save(record{Orders: []Order{o}})
+}
+
+// UpdateOrder changes the status of the known order, unknown orders are ignored
+func (s *Store) UpdateOrder(id int64, state uint8, matchID *int64, matchSwapica *string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[id]
+	if !ok {
+		return nil
+	}
+	o.State, o.MatchID, o.MatchSwapica = state, matchID, matchSwapica
+	s.orders[id] = o
+	return s.save(record{Orders: []Order{o}})
+}
+
+func (s *Store) PutMatch(m Match) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.matches[m.MatchID] = m
+	return s.save(record{Matches: []Match{m}})
+}
+
+// UpdateMatch changes the state of the known match, unknown matches are ignored
+func (s *Store) UpdateMatch(id int64, state uint8) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.matches[id]
+	if !ok {
+		return nil
+	}
+	m.State = state
+	s.matches[id] = m
+	return s.save(record{Matches: []Match{m}})
+}
+
+// UpdateOrderAmounts replaces the normalized amounts of the known order
+func (s *Store) UpdateOrderAmounts(id int64, n amount.Normalized) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[id]
+	if !ok {
+		return nil
+	}
+	o.Normalized = n
+	s.orders[id] = o
+	return s.save(record{Orders: []Order{o}})
+}
+
+// UpdateMatchAmounts replaces the normalized amounts of the known match
+func (s *Store) UpdateMatchAmounts(id int64, n amount.Normalized) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.matches[id]
+	if !ok {
+		return nil
+	}
+	m.Normalized = n
+	s.matches[id] = m
+	return s.save(record{Matches: []Match{m}})
+}
+
+// Reset removes all the orders and matches, the store is bootstrapped again
+// on the next start
+func (s *Store) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orders = make(map[int64]Order)
+	s.matches = make(map[int64]Match)
+	s.bootstrapped = false
+	return s.save(record{Reset: true})
+}
+
+// Bootstrapped reports whether the store was filled with the entities
+// created before it was enabled
+func (s *Store) Bootstrapped() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.bootstrapped
+}
+
+func (s *Store) MarkBootstrapped() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bootstrapped = true
+	return s.save(record{Bootstrapped: true})
+}
+
+func (s *Store) Order(id int64) (Order, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o, ok := s.orders[id]
+	return o, ok
+}
+
+func (s *Store) Match(id int64) (Match, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.matches[id]
+	return m, ok
+}
+
+// OrdersFilter fields are ignored when empty, addresses are case-insensitive
+type OrdersFilter struct {
+	Creator     string
+	TokenToSell string
+	TokenToBuy  string
+	State       *uint8
+	// Unnormalized selects the orders without the price
+	Unnormalized bool
+}
+
+func (f OrdersFilter) match(o Order) bool {
+	return matchAddress(f.Creator, o.Creator) &&
+		matchAddress(f.TokenToSell, o.TokenToSell) &&
+		matchAddress(f.TokenToBuy, o.TokenToBuy) &&
+		(f.State == nil || *f.State == o.State) &&
+		(!f.Unnormalized || o.Price == "")
+}
+
+type MatchesFilter struct {
+	Creator       string
+	TokenToSell   string
+	OriginOrderID *int64
+	State         *uint8
+	// Unnormalized selects the matches without the normalized amount
+	Unnormalized bool
+}
+
+func (f MatchesFilter) match(m Match) bool {
+	return matchAddress(f.Creator, m.Creator) &&
+		matchAddress(f.TokenToSell, m.TokenToSell) &&
+		(f.OriginOrderID == nil || *f.OriginOrderID == m.OriginOrderID) &&
+		(f.State == nil || *f.State == m.State) &&
+		(!f.Unnormalized || m.Normalized.AmountToSell == "")
+}
+
+// Page is zero-based
+type Page struct {
+	Number uint64
+	Limit  uint64
+}
+
+// apply computes the bounds in uint64 and clamps them to total before the
+// conversion, so no page number or limit can overflow them
+func (p Page) apply(total int) (from, to int) {
+	n := uint64(total)
+	if p.Limit == 0 || p.Number > n/p.Limit {
+		return total, total
+	}
+
+	start, end := p.Number*p.Limit, n
+	if p.Limit < n-start {
+		end = start + p.Limit
+	}
+	return int(start), int(end)
+}
+
+// Orders returns the filtered orders sorted by ID
+func (s *Store) Orders(filter OrdersFilter, page Page) []Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Order, 0)
+	for _, o := range s.orders {
+		if filter.match(o) {
+			result = append(result, o)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].OrderID < result[j].OrderID })
+
+	from, to := page.apply(len(result))
+	return result[from:to]
+}
+
+// Matches returns the filtered matches sorted by ID
+func (s *Store) Matches(filter MatchesFilter, page Page) []Match {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Match, 0)
+	for _, m := range s.matches {
+		if filter.match(m) {
+			result = append(result, m)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].MatchID < result[j].MatchID })
+
+	from, to := page.apply(len(result))
+	return result[from:to]
+}
+
+// save must be called with the lock held, it appends the change to the file
+// and compacts the file when the changes outnumber the entities
+func (s *Store) save(rec record) error {
+	if s.path == "" {
+		return nil
+	}
+
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal store record")
+	}
+	if _, err = s.file.Write(append(raw, '\n')); err != nil {
+		return errors.Wrap(err, "failed to append store record")
+	}
+
+	s.changes++
+	if s.changes < compactMinChanges || s.changes < len(s.orders)+len(s.matches) {
+		return nil
+	}
+	return s.compact()
+}
+
+// compact must be called with the lock held, the snapshot is written to a
+// temporary file first, so the existing one is never left half-written
+func (s *Store) compact() error {
+	rec := record{
+		Reset:        true,
+		Bootstrapped: s.bootstrapped,
+		Orders:       make([]Order, 0, len(s.orders)),
+		Matches:      make([]Match, 0, len(s.matches)),
+	}
+	for _, o := range s.orders {
+		rec.Orders = append(rec.Orders, o)
+	}
+	for _, m := range s.matches {
+		rec.Matches = append(rec.Matches, m)
+	}
+
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal snapshot")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary snapshot")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(append(raw, '\n')); err != nil {
+		_ = tmp.Close()
+		return errors.Wrap(err, "failed to write snapshot")
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed to close snapshot")
+	}
+
+	// the closed file fails the next writes when the new one can't be opened
+	if s.file != nil {
+		_ = s.file.Close()
+	}
+	if err = os.Rename(tmp.Name(), s.path); err != nil {
+		return errors.Wrap(err, "failed to replace snapshot")
+	}
+
+	s.file, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open store file")
+	}
+	s.changes = 0
+	return nil
+}
+
+func matchAddress(filter, address string) bool {
+	return filter == "" || strings.EqualFold(filter, address)
+}
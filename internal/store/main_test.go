@@ -0,0 +1,195 @@
+package store
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPageApply(t *testing.T) {
+	cases := []struct {
+		name     string
+		page     Page
+		total    int
+		from, to int
+	}{
+		{name: "first page", page: Page{Number: 0, Limit: 2}, total: 5, from: 0, to: 2},
+		{name: "middle page", page: Page{Number: 1, Limit: 2}, total: 5, from: 2, to: 4},
+		{name: "last partial page", page: Page{Number: 2, Limit: 2}, total: 5, from: 4, to: 5},
+		{name: "past the end", page: Page{Number: 3, Limit: 2}, total: 5, from: 5, to: 5},
+		{name: "zero limit", page: Page{Number: 0, Limit: 0}, total: 5, from: 5, to: 5},
+		{name: "empty", page: Page{Number: 0, Limit: 10}, total: 0, from: 0, to: 0},
+		{name: "limit above total", page: Page{Number: 0, Limit: math.MaxUint64}, total: 5, from: 0, to: 5},
+		{name: "huge number", page: Page{Number: math.MaxUint64, Limit: 2}, total: 5, from: 5, to: 5},
+		{name: "number times limit overflows", page: Page{Number: math.MaxUint64 / 2, Limit: 4}, total: 5, from: 5, to: 5},
+	}
+	for _, c := range cases {
+		from, to := c.page.apply(c.total)
+		if from != c.from || to != c.to {
+			t.Errorf("%s: apply(%d) = [%d, %d), want [%d, %d)", c.name, c.total, from, to, c.from, c.to)
+		}
+	}
+}
+
+func TestStoreOrdersPaging(t *testing.T) {
+	s, err := New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := int64(1); id <= 5; id++ {
+		creator := "0xAA"
+		if id%2 == 0 {
+			creator = "0xbb"
+		}
+		if err = s.PutOrder(Order{OrderID: id, Creator: creator, State: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name   string
+		filter OrdersFilter
+		page   Page
+		want   []int64
+	}{
+		{name: "all", page: Page{Limit: 10}, want: []int64{1, 2, 3, 4, 5}},
+		{name: "second page", page: Page{Number: 1, Limit: 2}, want: []int64{3, 4}},
+		{name: "creator case-insensitive", filter: OrdersFilter{Creator: "0xaa"}, page: Page{Limit: 10}, want: []int64{1, 3, 5}},
+		{name: "filtered page", filter: OrdersFilter{Creator: "0xBB"}, page: Page{Number: 1, Limit: 1}, want: []int64{4}},
+		{name: "no price", filter: OrdersFilter{Unnormalized: true}, page: Page{Limit: 2}, want: []int64{1, 2}},
+	}
+	for _, c := range cases {
+		got := s.Orders(c.filter, c.page)
+		if len(got) != len(c.want) {
+			t.Errorf("%s: got %d orders, want %d", c.name, len(got), len(c.want))
+			continue
+		}
+		for i, o := range got {
+			if o.OrderID != c.want[i] {
+				t.Errorf("%s: order %d is %d, want %d", c.name, i, o.OrderID, c.want[i])
+			}
+		}
+	}
+}
+
+func TestStoreApply(t *testing.T) {
+	matchID := int64(7)
+	cases := []struct {
+		name         string
+		records      []record
+		orders       int
+		matches      int
+		bootstrapped bool
+	}{
+		{
+			name:    "changes",
+			records: []record{{Orders: []Order{{OrderID: 1}}}, {Orders: []Order{{OrderID: 2}}, Matches: []Match{{MatchID: 1}}}},
+			orders:  2, matches: 1,
+		},
+		{
+			name:    "same entity replaced",
+			records: []record{{Orders: []Order{{OrderID: 1}}}, {Orders: []Order{{OrderID: 1, MatchID: &matchID}}}},
+			orders:  1,
+		},
+		{
+			name:         "bootstrapped",
+			records:      []record{{Orders: []Order{{OrderID: 1}}}, {Bootstrapped: true}},
+			orders:       1,
+			bootstrapped: true,
+		},
+		{
+			name:    "reset drops everything before it",
+			records: []record{{Bootstrapped: true, Orders: []Order{{OrderID: 1}}}, {Reset: true}, {Matches: []Match{{MatchID: 2}}}},
+			matches: 1,
+		},
+		{
+			name:         "snapshot",
+			records:      []record{{Orders: []Order{{OrderID: 1}}}, {Reset: true, Bootstrapped: true, Orders: []Order{{OrderID: 3}}}},
+			orders:       1,
+			bootstrapped: true,
+		},
+	}
+	for _, c := range cases {
+		s, _ := New("")
+		for _, rec := range c.records {
+			s.apply(rec)
+		}
+		if len(s.orders) != c.orders || len(s.matches) != c.matches || s.bootstrapped != c.bootstrapped {
+			t.Errorf("%s: got %d orders, %d matches, bootstrapped %v, want %d, %d, %v", c.name,
+				len(s.orders), len(s.matches), s.bootstrapped, c.orders, c.matches, c.bootstrapped)
+		}
+	}
+}
+
+func TestStoreCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.PutOrder(Order{OrderID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.PutMatch(Match{MatchID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// the last update reaches compactMinChanges and compacts the file
+	var state uint8
+	for i := 0; i < compactMinChanges-2; i++ {
+		state = uint8(i%2 + 1)
+		if err = s.UpdateOrder(1, state, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = s.MarkBootstrapped(); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the compacted snapshot and the change after it
+	if lines := countLines(t, path); lines != 2 {
+		t.Errorf("got %d lines after compaction, want 2", lines)
+	}
+
+	// a torn last record is dropped when the store is loaded
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteString(`{"orders":[{"order_id":2`); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	s, err = New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, ok := s.Order(2); ok {
+		t.Error("order of the torn record is loaded")
+	}
+	o, ok := s.Order(1)
+	if !ok || o.State != state {
+		t.Errorf("got order %+v, %v, want the last state", o, ok)
+	}
+	if _, ok = s.Match(1); !ok || !s.Bootstrapped() {
+		t.Error("match or bootstrapped flag is lost")
+	}
+	if lines := countLines(t, path); lines != 1 {
+		t.Errorf("got %d lines after loading, want 1", lines)
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(raw, []byte("\n"))
+}
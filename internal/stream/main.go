@@ -0,0 +1,95 @@
+package stream
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Swapica/indexer-svc/internal/notify"
+)
+
+const subscriberBuffer = 64
+
+type subscriber struct {
+	filter notify.Filter
+	events chan notify.Event
+}
+
+// Broker fans out the indexed events to the subscribers and keeps the recent
+// ones, so the subscribers can resume from a cursor after reconnect
+type Broker struct {
+	mu     sync.Mutex
+	recent []notify.Event
+	size   int
+	subs   map[*subscriber]struct{}
+}
+
+func NewBroker(size int) *Broker {
+	return &Broker{
+		size: size,
+		subs: make(map[*subscriber]struct{}),
+	}
+}
+
+// Notify never blocks: the subscriber that can't keep up is disconnected
+// and is expected to resume from its last cursor
+func (b *Broker) Notify(_ context.Context, e notify.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.recent = append(b.recent, e)
+	if len(b.recent) > b.size {
+		b.recent = b.recent[len(b.recent)-b.size:]
+	}
+
+	for s := range b.subs {
+		if !s.filter.Match(e) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			delete(b.subs, s)
+			close(s.events)
+		}
+	}
+
+	return nil
+}
+
+// Subscribe returns the recent events after the cursor, when it is set, and
+// the channel of the new ones. The channel is closed on unsubscribe or when
+// the subscriber is too slow.
+func (b *Broker) Subscribe(filter notify.Filter, cursor *string) (backlog []notify.Event, events <-chan notify.Event, unsubscribe func(), err error) {
+	var block uint64
+	var logIndex uint
+	if cursor != nil {
+		if block, logIndex, err = notify.ParseCursor(*cursor); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	s := &subscriber{filter: filter, events: make(chan notify.Event, subscriberBuffer)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if cursor != nil {
+		for _, e := range b.recent {
+			if notify.IsAfter(e, block, logIndex) && filter.Match(e) {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+	b.subs[s] = struct{}{}
+
+	unsubscribe = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[s]; ok {
+			delete(b.subs, s)
+			close(s.events)
+		}
+	}
+
+	return backlog, s.events, unsubscribe, nil
+}
@@ -0,0 +1,407 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Swapica/indexer-svc/internal/metrics"
+	"github.com/Swapica/indexer-svc/internal/notify"
+	"gitlab.com/distributed_lab/logan/v3"
+	"gitlab.com/distributed_lab/logan/v3/errors"
+)
+
+const (
+	SignatureHeader = "X-Swapica-Signature"
+	EventHeader     = "X-Swapica-Event"
+	DeliveryHeader  = "X-Swapica-Delivery"
+)
+
+// Subscription receives the events passing its filter. Secret is used to sign
+// the payloads and is never returned by the admin API.
+type Subscription struct {
+	ID      string `json:"id" fig:"id"`
+	URL     string `json:"url" fig:"url,required"`
+	Secret  string `json:"secret,omitempty" fig:"secret,required"`
+	Creator string `json:"creator,omitempty" fig:"creator"`
+	Token   string `json:"token,omitempty" fig:"token"`
+	OrderID *int64 `json:"order_id,omitempty" fig:"order_id"`
+}
+
+func (s Subscription) filter() notify.Filter {
+	return notify.Filter{Creator: s.Creator, Token: s.Token, OrderID: s.OrderID}
+}
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Delivery is a record of sending one event to one subscription
+type Delivery struct {
+	ID             string           `json:"id"`
+	SubscriptionID string           `json:"subscription_id"`
+	URL            string           `json:"url"`
+	EventType      notify.EventType `json:"event_type"`
+	Cursor         string           `json:"cursor"`
+	Status         string           `json:"status"`
+	Attempts       int              `json:"attempts"`
+	ResponseCode   int              `json:"response_code,omitempty"`
+	Error          string           `json:"error,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+type Opts struct {
+	Workers        int
+	QueueSize      int
+	MaxAttempts    int
+	RetryPeriod    time.Duration
+	MaxRetryPeriod time.Duration
+	Timeout        time.Duration
+	// KeepDeliveries is the number of the recent delivery records to keep
+	KeepDeliveries int
+}
+
+type job struct {
+	delivery *Delivery
+	sub      Subscription
+	event    notify.Event
+	// wait is the backoff before the next attempt
+	wait time.Duration
+}
+
+// Dispatcher sends the events to the subscriptions in background, so the
+// indexer is never blocked by slow receivers
+type Dispatcher struct {
+	log    *logan.Entry
+	opts   Opts
+	client *http.Client
+	queue  chan job
+	// pending counts the queued, the delayed and the running deliveries
+	pending sync.WaitGroup
+
+	mu         sync.RWMutex
+	subs       map[string]Subscription
+	deliveries []*Delivery
+	// delayed counts the jobs waiting for their retry
+	delayed int
+}
+
+func NewDispatcher(log *logan.Entry, opts Opts, subs []Subscription) (*Dispatcher, error) {
+	d := &Dispatcher{
+		log:    log.WithField("service", "webhooks"),
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		queue:  make(chan job, opts.QueueSize),
+		subs:   make(map[string]Subscription),
+	}
+	for _, s := range subs {
+		if _, err := d.Add(s); err != nil {
+			return nil, errors.Wrap(err, "failed to add subscription", logan.F{"url": s.URL})
+		}
+	}
+	return d, nil
+}
+
+// Run delivers the queued events until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < d.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-d.queue:
+					d.deliver(ctx, j)
+					d.pending.Done()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Flush waits until the queued deliveries are finished, Run must keep going
+// meanwhile. The deliveries left are reported by the returned error when ctx
+// is done first.
+func (d *Dispatcher) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		d.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		d.mu.RLock()
+		delayed := d.delayed
+		d.mu.RUnlock()
+		return errors.Wrap(ctx.Err(), "deliveries were not finished", logan.F{
+			"queued":  len(d.queue),
+			"delayed": delayed,
+		})
+	}
+}
+
+// Notify queues the event for every matching subscription. When the queue is
+// full the delivery is recorded as failed instead of blocking the indexer.
+func (d *Dispatcher) Notify(_ context.Context, e notify.Event) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, s := range d.subs {
+		if !s.filter().Match(e) {
+			continue
+		}
+
+		now := time.Now().UTC()
+		delivery := &Delivery{
+			ID:             newID(),
+			SubscriptionID: s.ID,
+			URL:            s.URL,
+			EventType:      e.Type,
+			Cursor:         e.Cursor,
+			Status:         StatusPending,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		d.record(delivery)
+
+		d.pending.Add(1)
+		select {
+		case d.queue <- job{delivery: delivery, sub: s, event: e, wait: d.opts.RetryPeriod}:
+		default:
+			d.pending.Done()
+			delivery.Status = StatusFailed
+			delivery.Error = "delivery queue is full"
+			metrics.WebhookDeliveries.Add(StatusFailed, 1)
+			d.log.WithFields(logan.F{
+				"subscription": s.ID,
+				"cursor":       e.Cursor,
+			}).Error("webhook delivery queue is full, dropping event")
+		}
+	}
+
+	return nil
+}
+
+// record must be called with the lock held
+func (d *Dispatcher) record(delivery *Delivery) {
+	d.deliveries = append(d.deliveries, delivery)
+	if len(d.deliveries) > d.opts.KeepDeliveries {
+		d.deliveries = d.deliveries[len(d.deliveries)-d.opts.KeepDeliveries:]
+	}
+}
+
+// deliver makes a single attempt, the failed ones are retried by retry, so
+// the workers are never blocked by the dead receivers
+func (d *Dispatcher) deliver(ctx context.Context, j job) {
+	log := d.log.WithFields(logan.F{
+		"subscription": j.sub.ID,
+		"delivery":     j.delivery.ID,
+		"cursor":       j.event.Cursor,
+	})
+
+	body, err := json.Marshal(j.event)
+	if err != nil {
+		d.finish(j.delivery, StatusFailed, 0, err)
+		log.WithError(err).Error("failed to marshal webhook payload")
+		return
+	}
+
+	code, err := d.send(ctx, j, body)
+	d.mu.Lock()
+	j.delivery.Attempts++
+	attempts := j.delivery.Attempts
+	d.mu.Unlock()
+
+	if err == nil {
+		d.finish(j.delivery, StatusDelivered, code, nil)
+		log.WithField("attempts", attempts).Debug("webhook delivered")
+		return
+	}
+	if attempts >= d.opts.MaxAttempts || ctx.Err() != nil {
+		d.finish(j.delivery, StatusFailed, code, err)
+		log.WithError(err).WithField("attempts", attempts).Error("webhook delivery failed")
+		return
+	}
+
+	d.update(j.delivery, code, err)
+	if !d.retry(ctx, j, code) {
+		d.finish(j.delivery, StatusFailed, code, errors.New("delivery retry queue is full"))
+		log.WithError(err).WithField("attempts", attempts).Error("webhook delivery failed, retry queue is full")
+		return
+	}
+	log.WithError(err).WithFields(logan.F{
+		"attempts": attempts,
+		"wait":     j.wait,
+	}).Warn("webhook delivery failed, retrying")
+}
+
+// retry queues the job again after its backoff, the delayed jobs are limited
+// by the queue size. It reports false when the limit is reached.
+func (d *Dispatcher) retry(ctx context.Context, j job, code int) bool {
+	d.mu.Lock()
+	if d.delayed >= d.opts.QueueSize {
+		d.mu.Unlock()
+		return false
+	}
+	d.delayed++
+	d.mu.Unlock()
+
+	next := j
+	if next.wait *= 2; next.wait > d.opts.MaxRetryPeriod {
+		next.wait = d.opts.MaxRetryPeriod
+	}
+	d.pending.Add(1)
+	time.AfterFunc(j.wait, func() {
+		defer func() {
+			d.mu.Lock()
+			d.delayed--
+			d.mu.Unlock()
+		}()
+		select {
+		case d.queue <- next:
+		case <-ctx.Done():
+			d.pending.Done()
+			d.finish(j.delivery, StatusFailed, code, ctx.Err())
+		}
+	})
+	return true
+}
+
+func (d *Dispatcher) send(ctx context.Context, j job, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(j.event.Type))
+	req.Header.Set(DeliveryHeader, j.delivery.ID)
+	req.Header.Set(SignatureHeader, Sign(j.sub.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to send request")
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.From(errors.New("unexpected response status"), logan.F{
+			"status": resp.StatusCode,
+		})
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) update(delivery *Delivery, code int, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delivery.ResponseCode = code
+	delivery.Error = err.Error()
+	delivery.UpdatedAt = time.Now().UTC()
+}
+
+func (d *Dispatcher) finish(delivery *Delivery, status string, code int, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delivery.Status = status
+	delivery.ResponseCode = code
+	delivery.Error = ""
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	delivery.UpdatedAt = time.Now().UTC()
+	metrics.WebhookDeliveries.Add(status, 1)
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of the body prefixed with
+// "sha256=", receivers should compare it with the signature header
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Add adds or replaces the subscription, a random ID is generated when it is empty
+func (d *Dispatcher) Add(s Subscription) (Subscription, error) {
+	if s.URL == "" {
+		return s, errors.New("url is required")
+	}
+	if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return s, errors.New("url must be absolute http or https one")
+	}
+	if s.Secret == "" {
+		return s, errors.New("secret is required")
+	}
+	if s.ID == "" {
+		s.ID = newID()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.subs[s.ID] = s
+	return s, nil
+}
+
+// Remove reports whether the subscription existed
+func (d *Dispatcher) Remove(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.subs[id]
+	delete(d.subs, id)
+	return ok
+}
+
+// Subscriptions are returned without secrets
+func (d *Dispatcher) Subscriptions() []Subscription {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	subs := make([]Subscription, 0, len(d.subs))
+	for _, s := range d.subs {
+		s.Secret = ""
+		subs = append(subs, s)
+	}
+	return subs
+}
+
+// Deliveries returns the recent deliveries, newest first, optionally of one
+// subscription only
+func (d *Dispatcher) Deliveries(subscriptionID string) []Delivery {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	result := make([]Delivery, 0, len(d.deliveries))
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		if subscriptionID == "" || d.deliveries[i].SubscriptionID == subscriptionID {
+			result = append(result, *d.deliveries[i])
+		}
+	}
+	return result
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
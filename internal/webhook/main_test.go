@@ -0,0 +1,40 @@
+package webhook
+
+import "testing"
+
+func TestSign(t *testing.T) {
+	cases := []struct {
+		name   string
+		secret string
+		body   string
+		want   string
+	}{
+		{
+			name:   "RFC 4231 test case 2",
+			secret: "Jefe",
+			body:   "what do ya want for nothing?",
+			want:   "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843",
+		},
+		{
+			name:   "empty body",
+			secret: "secret",
+			body:   "",
+			want:   "sha256=f9e66e179b6747ae54108f82f8ade8b3c25d76fd30afde6c395822c530196169",
+		},
+		{
+			name:   "event",
+			secret: "secret",
+			body:   `{"type":"order_created"}`,
+			want:   "sha256=cf76860d46472d920b1e1cf163051875f10114a95a037c09781698895176986f",
+		},
+	}
+	for _, c := range cases {
+		if got := Sign(c.secret, []byte(c.body)); got != c.want {
+			t.Errorf("%s: Sign = %q, want %q", c.name, got, c.want)
+		}
+	}
+
+	if Sign("secret", []byte("body")) == Sign("other", []byte("body")) {
+		t.Error("signatures with different secrets are equal")
+	}
+}